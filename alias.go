@@ -0,0 +1,215 @@
+package staert
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/containous/flaeg"
+)
+
+// rawTree is the raw key tree of a source, before it is decoded into the config
+type rawTree struct {
+	tree     map[string]interface{}
+	source   string                    // "toml", "kv" or "http"
+	location func(key []string) string // location of a key in the source, like "example.toml:12"
+	origins  map[string]string         // dotted keys moved by the aliases, to the dotted key they come from
+}
+
+// moved records that the key path newPath comes from the key path oldPath of the source
+func (raw *rawTree) moved(newPath, oldPath []string) {
+	if raw.origins == nil {
+		raw.origins = make(map[string]string)
+	}
+	raw.origins[strings.Join(newPath, ".")] = strings.Join(oldPath, ".")
+}
+
+// origin returns the dotted key of the source which the dotted key of the tree comes from
+func (raw *rawTree) origin(key string) string {
+	// a key may have been moved by several aliases
+	for i := 0; i < len(raw.origins); i++ {
+		moved := ""
+		for newKey := range raw.origins {
+			if len(newKey) > len(moved) && len(key) >= len(newKey) && strings.EqualFold(key[:len(newKey)], newKey) &&
+				(len(key) == len(newKey) || key[len(newKey)] == '.') {
+				moved = newKey
+			}
+		}
+		if len(moved) == 0 {
+			break
+		}
+		key = raw.origins[moved] + key[len(moved):]
+	}
+	return key
+}
+
+// treeRewriter rewrites the raw key tree of a source, it returns true if the tree changed
+type treeRewriter func(raw *rawTree) (bool, error)
+
+// rewritableSource is implemented by the sources which let Staert rewrite their raw key tree before decoding it
+type rewritableSource interface {
+	parseRewritten(cmd *flaeg.Command, rewrite treeRewriter) (*flaeg.Command, error)
+}
+
+// DeprecatedKeyWarning is emitted when a source uses the old key of a key alias
+type DeprecatedKeyWarning struct {
+	Source   string // "toml", "kv", "http" or "flag"
+	Location string // file and line, KV key or flag argument
+	OldKey   string
+	NewKey   string
+}
+
+func (w DeprecatedKeyWarning) String() string {
+	return fmt.Sprintf("%s: %s key %s is deprecated, use %s instead", w.Location, w.Source, w.OldKey, w.NewKey)
+}
+
+type keyAlias struct {
+	oldKey string
+	newKey string
+}
+
+// AddKeyAlias declares the key oldKey renamed newKey, keys are dotted paths like "Section.Name" (case insensitive)
+// The old key and the keys under it are loaded as the new ones by TomlSource, KvSource, HTTPSource and the flags rewritten by AliasArgs,
+// with a DeprecatedKeyWarning. If both keys are set, the new one is used.
+// Keys under TOML arrays of tables are not aliased
+func (s *Staert) AddKeyAlias(oldKey, newKey string) {
+	s.aliases = append(s.aliases, keyAlias{oldKey: oldKey, newKey: newKey})
+}
+
+// AliasArgs rewrites the flags of the old keys of the key aliases (e.g. "--oldname=1" to "--newsection.newname=1"),
+// give the result to flaeg.New
+func (s *Staert) AliasArgs(args []string) []string {
+	aliased := make([]string, len(args))
+	copy(aliased, args)
+
+	for i, arg := range args {
+		if arg == "--" {
+			// the following args are not flags
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimPrefix(arg, "--"))
+		value := ""
+		if equal := strings.Index(name, "="); equal >= 0 {
+			name, value = name[:equal], arg[len("--")+equal:]
+		}
+
+		// the aliases are applied in order, like on the raw key trees
+		for _, alias := range s.aliases {
+			oldFlag := strings.ToLower(alias.oldKey)
+			if name != oldFlag && !strings.HasPrefix(name, oldFlag+".") {
+				continue
+			}
+			name = strings.ToLower(alias.newKey) + name[len(oldFlag):]
+			aliased[i] = "--" + name + value
+			s.warnDeprecatedKey(DeprecatedKeyWarning{Source: "flag", Location: arg, OldKey: alias.oldKey, NewKey: alias.newKey})
+		}
+	}
+	return aliased
+}
+
+// rewriteTree upgrades the raw key tree of a source to the current configuration version, then applies the key aliases
+func (s *Staert) rewriteTree(raw *rawTree) (bool, error) {
+	upgraded, err := s.upgradeTree(raw)
+	if err != nil {
+		return false, err
+	}
+	aliased, err := s.aliasTree(raw)
+	return upgraded || aliased, err
+}
+
+// aliasTree applies the key aliases to the raw key tree of a source
+func (s *Staert) aliasTree(raw *rawTree) (bool, error) {
+	changed := false
+	for _, alias := range s.aliases {
+		oldPath, value, ok := findTreeKey(raw.tree, strings.Split(alias.oldKey, "."))
+		if !ok {
+			continue
+		}
+		s.warnDeprecatedKey(DeprecatedKeyWarning{Source: raw.source, Location: raw.location(oldPath), OldKey: alias.oldKey, NewKey: alias.newKey})
+		deleteTreeKey(raw.tree, oldPath)
+		changed = true
+
+		newPath := strings.Split(alias.newKey, ".")
+		if raw.source == "kv" {
+			// KV keys are lower case
+			newPath = strings.Split(strings.ToLower(alias.newKey), ".")
+		}
+		if _, _, ok := findTreeKey(raw.tree, newPath); ok {
+			continue
+		}
+		if err := setTreeKey(raw.tree, newPath, value); err != nil {
+			return changed, fmt.Errorf("can't alias %s to %s: %v", alias.oldKey, alias.newKey, err)
+		}
+		raw.moved(newPath, oldPath)
+	}
+	return changed, nil
+}
+
+func (s *Staert) warnDeprecatedKey(warning DeprecatedKeyWarning) {
+	if s.OnDeprecatedKey != nil {
+		s.OnDeprecatedKey(warning)
+		return
+	}
+	log.Print(warning)
+}
+
+// findTreeKey finds the key path in the tree case insensitively, it returns the path as written in the tree
+func findTreeKey(tree map[string]interface{}, path []string) ([]string, interface{}, bool) {
+	var found []string
+	var value interface{} = tree
+	for _, part := range path {
+		subTree, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil, false
+		}
+		key, ok := findTreeChild(subTree, part)
+		if !ok {
+			return nil, nil, false
+		}
+		found = append(found, key)
+		value = subTree[key]
+	}
+	return found, value, true
+}
+
+func findTreeChild(tree map[string]interface{}, name string) (string, bool) {
+	if _, ok := tree[name]; ok {
+		return name, true
+	}
+	for key := range tree {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// deleteTreeKey deletes the key path, as written in the tree
+func deleteTreeKey(tree map[string]interface{}, path []string) {
+	for _, part := range path[:len(path)-1] {
+		tree = tree[part].(map[string]interface{})
+	}
+	delete(tree, path[len(path)-1])
+}
+
+// setTreeKey sets the value of the key path, creating the missing tables
+func setTreeKey(tree map[string]interface{}, path []string, value interface{}) error {
+	for _, part := range path[:len(path)-1] {
+		key, ok := findTreeChild(tree, part)
+		if !ok {
+			key = part
+			tree[key] = make(map[string]interface{})
+		}
+		subTree, ok := tree[key].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not a table", key)
+		}
+		tree = subTree
+	}
+	tree[path[len(path)-1]] = value
+	return nil
+}
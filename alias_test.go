@@ -0,0 +1,149 @@
+package staert
+
+import (
+	"testing"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/containous/flaeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type AliasConfig struct {
+	Name       string        `description:"Name"`
+	NewSection *AliasSection `description:"New section"`
+}
+
+type AliasSection struct {
+	NewName string `description:"New name"`
+	Count   int    `description:"Count"`
+}
+
+func newAliasStaert(config *AliasConfig) (*Staert, *[]DeprecatedKeyWarning) {
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                config,
+		DefaultPointersConfig: &AliasConfig{NewSection: &AliasSection{NewName: "default"}},
+		Run: func() error {
+			return nil
+		},
+	}
+
+	s := NewStaert(cmd)
+	s.AddKeyAlias("Old", "Name")
+	s.AddKeyAlias("OldSection", "NewSection")
+	s.AddKeyAlias("NewSection.OldName", "NewSection.NewName")
+
+	var warnings []DeprecatedKeyWarning
+	s.OnDeprecatedKey = func(warning DeprecatedKeyWarning) {
+		warnings = append(warnings, warning)
+	}
+	return s, &warnings
+}
+
+func TestKeyAlias_toml(t *testing.T) {
+	config := &AliasConfig{}
+	s, warnings := newAliasStaert(config)
+
+	toml := NewTomlSource("alias", []string{"./fixtures/"})
+	s.AddSource(toml)
+
+	_, err := s.LoadConfig()
+	require.NoError(t, err)
+
+	expected := &AliasConfig{
+		Name:       "name",
+		NewSection: &AliasSection{NewName: "new name", Count: 2},
+	}
+	assert.Equal(t, expected, config)
+
+	file := toml.ConfigFileUsed()
+	expectedWarnings := []DeprecatedKeyWarning{
+		{Source: "toml", Location: file + ":2", OldKey: "Old", NewKey: "Name"},
+		{Source: "toml", Location: file + ":4", OldKey: "OldSection", NewKey: "NewSection"},
+		{Source: "toml", Location: file + ":5", OldKey: "NewSection.OldName", NewKey: "NewSection.NewName"},
+	}
+	assert.Equal(t, expectedWarnings, *warnings)
+	assert.Equal(t, file+":2: toml key Old is deprecated, use Name instead", (*warnings)[0].String())
+}
+
+func TestKeyAlias_tomlError(t *testing.T) {
+	s, _ := newAliasStaert(&AliasConfig{})
+
+	toml := NewTomlSource("aliasTypeError", []string{"./fixtures/"})
+	s.AddSource(toml)
+
+	_, err := s.LoadConfig()
+	require.Error(t, err)
+
+	tomlErr, ok := err.(*TomlError)
+	require.True(t, ok)
+	// located in the file, not in the rewritten document
+	assert.Equal(t, toml.ConfigFileUsed(), tomlErr.File)
+	assert.Equal(t, 6, tomlErr.Line)
+	assert.Equal(t, 1, tomlErr.Column)
+	assert.Equal(t, "NewSection.Count", tomlErr.Key)
+	assert.Equal(t, "NewSection.Count", tomlErr.Field)
+}
+
+func TestKeyAlias_kv(t *testing.T) {
+	config := &AliasConfig{}
+	s, warnings := newAliasStaert(config)
+
+	kv := &KvSource{
+		&Mock{
+			KVPairs: []*store.KVPair{
+				{Key: "prefix/old", Value: []byte("name")},
+				{Key: "prefix/oldsection/oldname", Value: []byte("new name")},
+				{Key: "prefix/oldsection/count", Value: []byte("2")},
+				{Key: "prefix/newsection/count", Value: []byte("3")},
+			},
+		},
+		"prefix",
+	}
+	s.AddSource(kv)
+
+	_, err := s.LoadConfig()
+	require.NoError(t, err)
+
+	// the new key wins
+	expected := &AliasConfig{
+		Name:       "name",
+		NewSection: &AliasSection{Count: 3},
+	}
+	assert.Equal(t, expected, config)
+
+	expectedWarnings := []DeprecatedKeyWarning{
+		{Source: "kv", Location: "prefix/old", OldKey: "Old", NewKey: "Name"},
+		{Source: "kv", Location: "prefix/oldsection", OldKey: "OldSection", NewKey: "NewSection"},
+	}
+	assert.Equal(t, expectedWarnings, *warnings)
+}
+
+func TestKeyAlias_flags(t *testing.T) {
+	config := &AliasConfig{}
+	s, warnings := newAliasStaert(config)
+
+	args := s.AliasArgs([]string{"--Old=name", "--oldsection.oldname", "new name", "--oldsection", "--", "--old"})
+	assert.Equal(t, []string{"--name=name", "--newsection.newname", "new name", "--newsection", "--", "--old"}, args)
+	require.Len(t, *warnings, 4)
+
+	expectedWarning := DeprecatedKeyWarning{Source: "flag", Location: "--Old=name", OldKey: "Old", NewKey: "Name"}
+	assert.Equal(t, expectedWarning, (*warnings)[0])
+}
+
+func TestKeyAlias_flagsLoadConfig(t *testing.T) {
+	config := &AliasConfig{}
+	s, _ := newAliasStaert(config)
+
+	s.AddSource(flaeg.New(s.command, s.AliasArgs([]string{"--old=name", "--oldsection.count=2"})))
+
+	_, err := s.LoadConfig()
+	require.NoError(t, err)
+
+	expected := &AliasConfig{
+		Name:       "name",
+		NewSection: &AliasSection{NewName: "default", Count: 2},
+	}
+	assert.Equal(t, expected, config)
+}
@@ -0,0 +1,106 @@
+package staert
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/containous/flaeg"
+)
+
+// setConfigFile sets the config file of the TomlSources to the value of the ConfigFileFlag,
+// parsed from the flaeg source args into a copy of the command config
+func (s *Staert) setConfigFile(cmd *flaeg.Command) error {
+	if len(s.ConfigFileFlag) == 0 {
+		return nil
+	}
+
+	config := cmd.Config
+	for _, src := range s.sources {
+		if flg, ok := src.(*flaeg.Flaeg); ok {
+			cmdCopy := *cmd
+			cmdCopy.Config = deepCopy(cmd.Config)
+			cmdCopy.DefaultPointersConfig = deepCopy(cmd.DefaultPointersConfig)
+			// flaeg prints the errors, the sources are not parsed to print them once
+			if _, err := flg.Parse(&cmdCopy); err != nil {
+				return err
+			}
+			config = cmdCopy.Config
+		}
+	}
+
+	configFile, err := flagValue(config, s.ConfigFileFlag)
+	if err != nil {
+		return err
+	}
+	for _, src := range s.sources {
+		if ts, ok := src.(*TomlSource); ok {
+			ts.configFile = configFile
+		}
+	}
+	return nil
+}
+
+// flagValue returns the value of the string field of the flag (like "section.name") in config
+// The value is empty if the field is under a nil pointer
+func flagValue(config interface{}, flag string) (string, error) {
+	value := reflect.ValueOf(config)
+	for _, name := range strings.Split(flag, ".") {
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return "", nil
+			}
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.Struct {
+			return "", fmt.Errorf("unknown flag %s", flag)
+		}
+		field, ok := findFlagField(value, name)
+		if !ok {
+			return "", fmt.Errorf("unknown flag %s", flag)
+		}
+		value = field
+	}
+
+	if value.Kind() != reflect.String {
+		return "", fmt.Errorf("flag %s is not a string", flag)
+	}
+	return value.String(), nil
+}
+
+// findFlagField finds the field of the flag name in the struct value, like flaeg does:
+// the fields with a description are flags, named after their "long" tag or their name (case insensitive),
+// and the fields of the embedded structs are promoted
+func findFlagField(value reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Anonymous {
+			embedded := value.Field(i)
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() != reflect.Struct {
+				continue
+			}
+			if found, ok := findFlagField(embedded, name); ok {
+				return found, true
+			}
+			continue
+		}
+		if len(field.Tag.Get("description")) == 0 {
+			continue
+		}
+
+		flagName := field.Name
+		if long := field.Tag.Get("long"); len(long) > 0 {
+			flagName = long
+		}
+		if strings.EqualFold(flagName, name) {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
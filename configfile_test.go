@@ -0,0 +1,134 @@
+package staert
+
+import (
+	"testing"
+
+	"github.com/containous/flaeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ConfigFileConfig struct {
+	ConfigFile string   `long:"config" short:"c" description:"Configuration file"`
+	PtrStruct1 *Struct1 `description:"Enable Struct1"`
+}
+
+func TestStaert_ConfigFileFlag(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		args     []string
+		expected *ConfigFileConfig
+		err      string
+	}{
+		{
+			desc: "file",
+			args: []string{"--config=./fixtures/trivial.toml"},
+			expected: &ConfigFileConfig{
+				ConfigFile: "./fixtures/trivial.toml",
+				PtrStruct1: &Struct1{S1Int: 28, S1String: "S1StringDefaultPointersConfig", S1Bool: true},
+			},
+		},
+		{
+			desc: "directory with short flag",
+			args: []string{"-c", "./fixtures"},
+			expected: &ConfigFileConfig{
+				ConfigFile: "./fixtures",
+				PtrStruct1: &Struct1{S1Int: 28, S1String: "S1StringDefaultPointersConfig", S1Bool: true},
+			},
+		},
+		{
+			desc:     "no flag",
+			expected: &ConfigFileConfig{},
+		},
+		{
+			desc: "file not found",
+			args: []string{"--config=./fixtures/missing.toml"},
+			err:  "config file ./fixtures/missing.toml not found",
+		},
+		{
+			desc: "file can't be checked",
+			args: []string{"--config=/invalid\x00path"},
+			err:  "config file /invalid\x00path not found: stat /invalid\x00path: invalid argument",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			rootCmd := &flaeg.Command{
+				Name:                  "test",
+				Config:                &ConfigFileConfig{},
+				DefaultPointersConfig: &ConfigFileConfig{PtrStruct1: &Struct1{S1String: "S1StringDefaultPointersConfig", S1Bool: true}},
+				Run: func() error {
+					return nil
+				},
+			}
+
+			s := NewStaert(rootCmd)
+			s.ConfigFileFlag = "config"
+			s.AddSource(NewTomlSource("trivial", []string{"./nothing"}))
+			s.AddSource(flaeg.New(rootCmd, test.args))
+
+			config, err := s.LoadConfig()
+			if len(test.err) > 0 {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, config)
+		})
+	}
+}
+
+func Test_flagValue(t *testing.T) {
+	type Section struct {
+		File string `long:"path" description:"File"`
+		Size int    `description:"Size"`
+	}
+	type Embedded struct {
+		Name string `description:"Name"`
+	}
+	type Config struct {
+		Embedded
+		Section    *Section `description:"Section"`
+		NilSection *Section `description:"Nil section"`
+		NoFlag     string
+	}
+
+	config := &Config{
+		Embedded: Embedded{Name: "name"},
+		Section:  &Section{File: "file"},
+	}
+
+	testCases := []struct {
+		flag     string
+		expected string
+		err      string
+	}{
+		{flag: "name", expected: "name"},
+		{flag: "section.path", expected: "file"},
+		{flag: "Section.Path", expected: "file"},
+		{flag: "nilsection.path", expected: ""},
+		{flag: "section.file", err: "unknown flag section.file"},
+		{flag: "noflag", err: "unknown flag noflag"},
+		{flag: "name.path", err: "unknown flag name.path"},
+		{flag: "section.size", err: "flag section.size is not a string"},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.flag, func(t *testing.T) {
+			t.Parallel()
+
+			value, err := flagValue(config, test.flag)
+			if len(test.err) > 0 {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, value)
+		})
+	}
+}
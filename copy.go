@@ -0,0 +1,79 @@
+package staert
+
+import "reflect"
+
+// deepCopy returns a deep copy of config, nil if config is nil
+// Unexported fields are shallow copied, func and chan values are shared and the config must not be cyclic
+func deepCopy(config interface{}) interface{} {
+	if config == nil {
+		return nil
+	}
+	value := reflect.ValueOf(config)
+	copied := reflect.New(value.Type()).Elem()
+	deepCopyValue(copied, value)
+	return copied.Interface()
+}
+
+// deepCopyValue copies src into dst, which must be settable and zero
+func deepCopyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.New(src.Type().Elem()))
+		deepCopyValue(dst.Elem(), src.Elem())
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		value := reflect.New(src.Elem().Type()).Elem()
+		deepCopyValue(value, src.Elem())
+		dst.Set(value)
+	case reflect.Struct:
+		// copy the unexported fields
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if src.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			dst.Field(i).Set(reflect.Zero(src.Field(i).Type()))
+			deepCopyValue(dst.Field(i), src.Field(i))
+		}
+	case reflect.Map:
+		deepCopyMap(dst, src)
+	case reflect.Slice:
+		deepCopySlice(dst, src)
+	case reflect.Array:
+		deepCopyElems(dst, src)
+	default:
+		dst.Set(src)
+	}
+}
+
+func deepCopyMap(dst, src reflect.Value) {
+	if src.IsNil() {
+		return
+	}
+	dst.Set(reflect.MakeMap(src.Type()))
+	for _, key := range src.MapKeys() {
+		value := reflect.New(src.Type().Elem()).Elem()
+		deepCopyValue(value, src.MapIndex(key))
+		dst.SetMapIndex(key, value)
+	}
+}
+
+func deepCopySlice(dst, src reflect.Value) {
+	if src.IsNil() {
+		return
+	}
+	dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+	deepCopyElems(dst, src)
+}
+
+// deepCopyElems copies the elements of the slice or array src into dst, which has the same length
+func deepCopyElems(dst, src reflect.Value) {
+	for i := 0; i < src.Len(); i++ {
+		deepCopyValue(dst.Index(i), src.Index(i))
+	}
+}
@@ -0,0 +1,58 @@
+package staert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_deepCopy(t *testing.T) {
+	type Config struct {
+		Ptr       *Struct1
+		Map       map[string]*Struct3
+		Slice     []Struct2
+		Array     [2]*Struct3
+		Interface interface{}
+		Duration  parse.Duration
+		internal  *Struct3
+	}
+
+	internal := &Struct3{S3Float64: 1}
+	config := &Config{
+		Ptr:       &Struct1{S1Int: 1, S1PtrStruct3: &Struct3{S3Float64: 1.1}},
+		Map:       map[string]*Struct3{"a": {S3Float64: 2}},
+		Slice:     []Struct2{{S2String: "s"}},
+		Array:     [2]*Struct3{{S3Float64: 3}},
+		Interface: &Struct3{S3Float64: 4},
+		Duration:  parse.Duration(time.Second),
+		internal:  internal,
+	}
+
+	copied := deepCopy(config).(*Config)
+	assert.Equal(t, config, copied)
+
+	copied.Ptr.S1PtrStruct3.S3Float64 = 0
+	copied.Map["a"].S3Float64 = 0
+	copied.Map["b"] = nil
+	copied.Slice[0].S2String = ""
+	copied.Array[0].S3Float64 = 0
+	copied.Interface.(*Struct3).S3Float64 = 0
+
+	expected := &Config{
+		Ptr:       &Struct1{S1Int: 1, S1PtrStruct3: &Struct3{S3Float64: 1.1}},
+		Map:       map[string]*Struct3{"a": {S3Float64: 2}},
+		Slice:     []Struct2{{S2String: "s"}},
+		Array:     [2]*Struct3{{S3Float64: 3}},
+		Interface: &Struct3{S3Float64: 4},
+		Duration:  parse.Duration(time.Second),
+		internal:  internal,
+	}
+	assert.Equal(t, expected, config)
+
+	// unexported fields are shallow copied
+	assert.True(t, internal == copied.internal)
+
+	assert.Nil(t, deepCopy(nil))
+}
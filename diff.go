@@ -0,0 +1,84 @@
+package staert
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ChangeType is the kind of change made on a key
+type ChangeType string
+
+const (
+	// KeyAdded : the key doesn't exist yet
+	KeyAdded ChangeType = "added"
+	// KeyModified : the key exists with another value
+	KeyModified ChangeType = "modified"
+	// KeyRemoved : the key exists but doesn't belong to the configuration anymore
+	KeyRemoved ChangeType = "removed"
+)
+
+// KeyChange describes a key to add, modify or remove
+type KeyChange struct {
+	Key      string
+	Type     ChangeType
+	OldValue string
+	NewValue string
+}
+
+func (c KeyChange) String() string {
+	switch c.Type {
+	case KeyAdded:
+		return fmt.Sprintf("%s: added %q", c.Key, c.NewValue)
+	case KeyRemoved:
+		return fmt.Sprintf("%s: removed %q", c.Key, c.OldValue)
+	default:
+		return fmt.Sprintf("%s: %q -> %q", c.Key, c.OldValue, c.NewValue)
+	}
+}
+
+// Diff returns the changes between two configurations of the same type, sorted by key
+// The keys are the paths of the changed fields, named as KvSource stores them (without prefix), like "ptrstruct1/s1int"
+func Diff(oldConfig, newConfig interface{}) ([]KeyChange, error) {
+	oldType := reflect.TypeOf(oldConfig)
+	newType := reflect.TypeOf(newConfig)
+	if oldType != newType {
+		return nil, fmt.Errorf("can't diff configurations of different types: %v and %v", oldType, newType)
+	}
+	if oldType == nil {
+		return nil, errors.New("can't diff nil configurations")
+	}
+
+	oldKv := map[string]string{}
+	if err := collateKvRecursive(reflect.ValueOf(oldConfig), oldKv, ""); err != nil {
+		return nil, err
+	}
+	newKv := map[string]string{}
+	if err := collateKvRecursive(reflect.ValueOf(newConfig), newKv, ""); err != nil {
+		return nil, err
+	}
+	return diffKv(oldKv, newKv), nil
+}
+
+// diffKv returns the changes to apply on oldKv to get newKv, sorted by key
+func diffKv(oldKv map[string]string, newKv map[string]string) []KeyChange {
+	var changes []KeyChange
+	for k, newValue := range newKv {
+		oldValue, ok := oldKv[k]
+		if !ok {
+			changes = append(changes, KeyChange{Key: k, Type: KeyAdded, NewValue: newValue})
+		} else if oldValue != newValue {
+			changes = append(changes, KeyChange{Key: k, Type: KeyModified, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+	for k, oldValue := range oldKv {
+		if _, ok := newKv[k]; !ok {
+			changes = append(changes, KeyChange{Key: k, Type: KeyRemoved, OldValue: oldValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
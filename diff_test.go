@@ -0,0 +1,101 @@
+package staert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	oldConfig := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:    1,
+			S1String: "S1StringInitConfig",
+		},
+		DurationField: parse.Duration(time.Second),
+	}
+	newConfig := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:    2,
+			S1String: "S1StringInitConfig",
+		},
+		PtrStruct2: &Struct2{
+			S2String: "S2String",
+		},
+		DurationField: parse.Duration(time.Second),
+	}
+
+	changes, err := Diff(oldConfig, newConfig)
+	require.NoError(t, err)
+
+	expected := []KeyChange{
+		{Key: "ptrstruct1/s1int", Type: KeyModified, OldValue: "1", NewValue: "2"},
+		{Key: "ptrstruct2/", Type: KeyAdded},
+		{Key: "ptrstruct2/s2bool", Type: KeyAdded, NewValue: "false"},
+		{Key: "ptrstruct2/s2int64", Type: KeyAdded, NewValue: "0"},
+		{Key: "ptrstruct2/s2string", Type: KeyAdded, NewValue: "S2String"},
+	}
+	assert.Equal(t, expected, changes)
+}
+
+func TestDiffSame(t *testing.T) {
+	config := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int: 1,
+		},
+	}
+
+	changes, err := Diff(config, config)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestDiffDifferentTypes(t *testing.T) {
+	_, err := Diff(&StructPtr{}, &Struct1{})
+	assert.EqualError(t, err, "can't diff configurations of different types: *staert.StructPtr and *staert.Struct1")
+}
+
+func TestDiffNil(t *testing.T) {
+	_, err := Diff(nil, nil)
+	assert.EqualError(t, err, "can't diff nil configurations")
+
+	changes, err := Diff((*StructPtr)(nil), (*StructPtr)(nil))
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestKeyChangeString(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		change   KeyChange
+		expected string
+	}{
+		{
+			desc:     "added",
+			change:   KeyChange{Key: "vfoo", Type: KeyAdded, NewValue: "toto"},
+			expected: `vfoo: added "toto"`,
+		},
+		{
+			desc:     "modified",
+			change:   KeyChange{Key: "vfoo", Type: KeyModified, OldValue: "toto", NewValue: "tata"},
+			expected: `vfoo: "toto" -> "tata"`,
+		},
+		{
+			desc:     "removed",
+			change:   KeyChange{Key: "vfoo", Type: KeyRemoved, OldValue: "toto"},
+			expected: `vfoo: removed "toto"`,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.expected, test.change.String())
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package staert
+
+import (
+	"encoding"
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/containous/flaeg"
+)
+
+// ConfigKeyDoc documents a configuration key as it appears in each source
+// It has no environment variable name: staert has no environment variable source
+type ConfigKeyDoc struct {
+	// TomlPath is the key in a TOML file, e.g. "PtrStruct1.S1Int"
+	TomlPath string
+	// KvKey is the key stored by KvSource under its prefix, e.g. "ptrstruct1/s1int"
+	KvKey string
+	// Flag is the flaeg flag, e.g. "--ptrstruct1.s1int", empty if the field has no flag
+	Flag string
+	// ShortFlag is the flaeg short flag, e.g. "-v", empty if none
+	ShortFlag   string
+	Type        string
+	Default     string
+	Description string
+}
+
+// ListConfigKeys lists the keys of the command configuration, in the fields declaration order
+// A pointer on a struct is listed before its fields, its default tells if it is set in Config,
+// the defaults of the fields under a pointer come from DefaultPointersConfig.
+// Map and slice keys are listed once, with a "<key>" or "<index>" placeholder in their KV key
+func ListConfigKeys(cmd *flaeg.Command) ([]ConfigKeyDoc, error) {
+	value := indirectValue(reflect.ValueOf(cmd.Config))
+	if !value.IsValid() {
+		return nil, fmt.Errorf("command %s has no config", cmd.Name)
+	}
+
+	var keys []ConfigKeyDoc
+	err := listConfigKeysRecursive(value.Type(), value, indirectValue(reflect.ValueOf(cmd.DefaultPointersConfig)), ConfigKeyDoc{}, true, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// listConfigKeysRecursive lists the keys of the fields of the struct type typ, parent holds the paths of the struct
+func listConfigKeysRecursive(typ reflect.Type, value reflect.Value, defaultPointersValue reflect.Value, parent ConfigKeyDoc, hasFlag bool, keys *[]ConfigKeyDoc) error {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tomlName := strings.Split(field.Tag.Get("toml"), ",")[0]
+		fieldValue := fieldByIndex(value, i)
+		fieldDefaultPointersValue := fieldByIndex(defaultPointersValue, i)
+
+		switch {
+		case field.PkgPath != "" && !field.Anonymous:
+			//if unexported field
+		case tomlName == "-":
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			// embedded struct fields are promoted by TOML and flaeg, by KvSource only if squashed
+			embedded := parent
+			if tomlName != "" {
+				embedded.TomlPath = joinKey(parent.TomlPath, ".", tomlName)
+			}
+			if !strings.Contains(string(field.Tag), "squash") {
+				embedded.KvKey = joinKey(parent.KvKey, "/", strings.ToLower(field.Name))
+			}
+			if err := listConfigKeysRecursive(field.Type, fieldValue, fieldDefaultPointersValue, embedded, hasFlag, keys); err != nil {
+				return err
+			}
+		case field.PkgPath != "":
+		default:
+			key, fieldHasFlag := newConfigKeyDoc(field, tomlName, parent, hasFlag)
+			if err := listFieldConfigKeys(field.Type, fieldValue, fieldDefaultPointersValue, key, fieldHasFlag, keys); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newConfigKeyDoc returns the key of the field, and true if the field has a flag
+func newConfigKeyDoc(field reflect.StructField, tomlName string, parent ConfigKeyDoc, hasFlag bool) (ConfigKeyDoc, bool) {
+	if tomlName == "" {
+		tomlName = field.Name
+	}
+	key := ConfigKeyDoc{
+		TomlPath:    joinKey(parent.TomlPath, ".", tomlName),
+		KvKey:       joinKey(parent.KvKey, "/", strings.ToLower(field.Name)),
+		Type:        field.Type.String(),
+		Description: field.Tag.Get("description"),
+	}
+
+	// flaeg only creates flags for the described fields
+	if !hasFlag || len(key.Description) == 0 {
+		return key, false
+	}
+	flagName := field.Name
+	if long := field.Tag.Get("long"); len(long) > 0 {
+		flagName = long
+	}
+	key.Flag = "--" + joinKey(strings.TrimPrefix(parent.Flag, "--"), ".", strings.ToLower(flagName))
+	if short := field.Tag.Get("short"); len(short) > 0 {
+		key.ShortFlag = "-" + short
+	}
+	return key, true
+}
+
+// listFieldConfigKeys lists key, and the keys under it for the structs and the pointers to structs
+func listFieldConfigKeys(fieldType reflect.Type, fieldValue reflect.Value, fieldDefaultPointersValue reflect.Value, key ConfigKeyDoc, hasFlag bool, keys *[]ConfigKeyDoc) error {
+	if fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct && !isTextMarshaler(fieldType) {
+		key.Default = fmt.Sprint(fieldValue.IsValid() && !fieldValue.IsNil())
+		dirKey := key
+		dirKey.KvKey += "/"
+		*keys = append(*keys, dirKey)
+
+		// the fields under a pointer get the DefaultPointersConfig values
+		elemValue := indirectValue(fieldDefaultPointersValue)
+		if !elemValue.IsValid() {
+			elemValue = indirectValue(fieldValue)
+		}
+		return listConfigKeysRecursive(fieldType.Elem(), elemValue, indirectValue(fieldDefaultPointersValue), key, hasFlag, keys)
+	}
+
+	if fieldType.Kind() == reflect.Struct && !isTextMarshaler(fieldType) {
+		return listConfigKeysRecursive(fieldType, fieldValue, fieldDefaultPointersValue, key, hasFlag, keys)
+	}
+	return listLeafConfigKey(fieldType, fieldValue, key, keys)
+}
+
+// listLeafConfigKey lists the key of a field holding a value, a map or a slice
+func listLeafConfigKey(fieldType reflect.Type, fieldValue reflect.Value, key ConfigKeyDoc, keys *[]ConfigKeyDoc) error {
+	switch {
+	case fieldType.Kind() == reflect.Map:
+		key.KvKey += "/<key>"
+	case (fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array) && fieldType.Elem().Kind() != reflect.Uint8:
+		key.KvKey += "/<index>"
+	}
+
+	defaultValue, err := docDefault(fieldValue)
+	if err != nil {
+		return fmt.Errorf("error marshaling key %s: %v", key.TomlPath, err)
+	}
+	key.Default = defaultValue
+	*keys = append(*keys, key)
+	return nil
+}
+
+// docDefault formats a default value, empty if value is invalid, nil or empty
+func docDefault(value reflect.Value) (string, error) {
+	value = indirectValue(value)
+	if !value.IsValid() {
+		return "", nil
+	}
+	if value.CanAddr() {
+		value = value.Addr()
+	}
+	if marshaler, ok := value.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(text), nil
+	}
+	value = reflect.Indirect(value)
+	switch value.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		if value.Len() == 0 {
+			return "", nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return string(value.Bytes()), nil
+		}
+	}
+	return fmt.Sprint(value.Interface()), nil
+}
+
+func isTextMarshaler(typ reflect.Type) bool {
+	textMarshalerType := reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	if typ.Kind() != reflect.Ptr {
+		typ = reflect.PtrTo(typ)
+	}
+	return typ.Implements(textMarshalerType)
+}
+
+func joinKey(parent string, separator string, name string) string {
+	if len(parent) == 0 {
+		return name
+	}
+	return parent + separator + name
+}
+
+// WriteMarkdownDocs writes the reference documentation of the command configuration as a Markdown table
+func WriteMarkdownDocs(cmd *flaeg.Command, w io.Writer) error {
+	keys, err := ListConfigKeys(cmd)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "# %s\n\n", cmd.Name)
+	if len(cmd.Description) > 0 {
+		fmt.Fprintf(w, "%s\n\n", cmd.Description)
+	}
+	fmt.Fprintln(w, "| TOML | KV | Flag | Type | Default | Description |")
+	fmt.Fprintln(w, "|------|----|------|------|---------|-------------|")
+	for _, key := range keys {
+		_, err := fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s |\n",
+			markdownCode(key.TomlPath),
+			markdownCode(key.KvKey),
+			markdownCode(strings.TrimPrefix(key.ShortFlag+", "+key.Flag, ", ")),
+			markdownCode(key.Type),
+			markdownCode(key.Default),
+			markdownEscape(key.Description))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func markdownCode(s string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return "`" + markdownEscape(s) + "`"
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+var htmlDocsTemplate = template.Must(template.New("docs").Parse(`<h1>{{ .Name }}</h1>
+{{ with .Description }}<p>{{ . }}</p>
+{{ end }}<table>
+<thead>
+<tr><th>TOML</th><th>KV</th><th>Flag</th><th>Type</th><th>Default</th><th>Description</th></tr>
+</thead>
+<tbody>
+{{ range .Keys }}<tr><td><code>{{ .TomlPath }}</code></td><td><code>{{ .KvKey }}</code></td><td>{{ with .ShortFlag }}<code>{{ . }}</code>, {{ end }}{{ with .Flag }}<code>{{ . }}</code>{{ end }}</td><td><code>{{ .Type }}</code></td><td>{{ with .Default }}<code>{{ . }}</code>{{ end }}</td><td>{{ .Description }}</td></tr>
+{{ end }}</tbody>
+</table>
+`))
+
+// WriteHTMLDocs writes the reference documentation of the command configuration as an HTML table
+func WriteHTMLDocs(cmd *flaeg.Command, w io.Writer) error {
+	keys, err := ListConfigKeys(cmd)
+	if err != nil {
+		return err
+	}
+
+	return htmlDocsTemplate.Execute(w, struct {
+		Name        string
+		Description string
+		Keys        []ConfigKeyDoc
+	}{cmd.Name, cmd.Description, keys})
+}
@@ -0,0 +1,119 @@
+package staert
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/containous/flaeg"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListConfigKeys(t *testing.T) {
+	rootCmd := &flaeg.Command{
+		Name:        "test",
+		Description: "description test",
+		Config: &StructPtr{
+			PtrStruct1: &Struct1{
+				S1Int:    1,
+				S1String: "S1StringInitConfig",
+			},
+			DurationField: parse.Duration(28 * time.Second),
+		},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run:                   func() error { return nil },
+	}
+
+	keys, err := ListConfigKeys(rootCmd)
+	require.NoError(t, err)
+
+	expected := []ConfigKeyDoc{
+		{TomlPath: "PtrStruct1", KvKey: "ptrstruct1/", Flag: "--ptrstruct1", Type: "*staert.Struct1", Default: "true", Description: "Enable Struct1"},
+		{TomlPath: "PtrStruct1.S1Int", KvKey: "ptrstruct1/s1int", Flag: "--ptrstruct1.s1int", Type: "int", Default: "11", Description: "Struct 1 Int"},
+		{TomlPath: "PtrStruct1.S1String", KvKey: "ptrstruct1/s1string", Flag: "--ptrstruct1.s1string", Type: "string", Default: "S1StringDefaultPointersConfig", Description: "Struct 1 String"},
+		{TomlPath: "PtrStruct1.S1Bool", KvKey: "ptrstruct1/s1bool", Flag: "--ptrstruct1.s1bool", Type: "bool", Default: "true", Description: "Struct 1 Bool"},
+		{TomlPath: "PtrStruct1.S1PtrStruct3", KvKey: "ptrstruct1/s1ptrstruct3/", Flag: "--ptrstruct1.s1ptrstruct3", Type: "*staert.Struct3", Default: "true", Description: "Enable Struct3"},
+		{TomlPath: "PtrStruct1.S1PtrStruct3.S3Float64", KvKey: "ptrstruct1/s1ptrstruct3/s3float64", Flag: "--ptrstruct1.s1ptrstruct3.s3float64", Type: "float64", Default: "11.11", Description: "Struct 3 float64"},
+		{TomlPath: "PtrStruct2", KvKey: "ptrstruct2/", Flag: "--ptrstruct2", Type: "*staert.Struct2", Default: "false", Description: "Enable Struct1"},
+		{TomlPath: "PtrStruct2.S2Int64", KvKey: "ptrstruct2/s2int64", Flag: "--ptrstruct2.s2int64", Type: "int64", Default: "22", Description: "Struct 2 Int64"},
+		{TomlPath: "PtrStruct2.S2String", KvKey: "ptrstruct2/s2string", Flag: "--ptrstruct2.s2string", Type: "string", Default: "S2StringDefaultPointersConfig", Description: "Struct 2 String"},
+		{TomlPath: "PtrStruct2.S2Bool", KvKey: "ptrstruct2/s2bool", Flag: "--ptrstruct2.s2bool", Type: "bool", Default: "false", Description: "Struct 2 Bool"},
+		{TomlPath: "DurationField", KvKey: "durationfield", Flag: "--durationfield", Type: "parse.Duration", Default: "28s", Description: "Duration Field"},
+	}
+	assert.Equal(t, expected, keys)
+}
+
+func TestListConfigKeysNames(t *testing.T) {
+	type Embedded struct {
+		EmbeddedString string `description:"embedded"`
+	}
+	type Squashed struct {
+		SquashedString string `description:"squashed"`
+	}
+	type Config struct {
+		Embedded
+		Squashed `mapstructure:",squash"`
+		Version  string `short:"v" long:"ver" description:"version"`
+		Renamed  string `toml:"renamed" description:"renamed"`
+		NoFlag   string
+		Ignored  string            `toml:"-"`
+		Map      map[string]string `description:"map"`
+		Slice    []int             `description:"slice"`
+	}
+
+	keys, err := ListConfigKeys(&flaeg.Command{Name: "test", Config: &Config{Slice: []int{1, 2}}})
+	require.NoError(t, err)
+
+	expected := []ConfigKeyDoc{
+		{TomlPath: "EmbeddedString", KvKey: "embedded/embeddedstring", Flag: "--embeddedstring", Type: "string", Description: "embedded"},
+		{TomlPath: "SquashedString", KvKey: "squashedstring", Flag: "--squashedstring", Type: "string", Description: "squashed"},
+		{TomlPath: "Version", KvKey: "version", Flag: "--ver", ShortFlag: "-v", Type: "string", Description: "version"},
+		{TomlPath: "renamed", KvKey: "renamed", Flag: "--renamed", Type: "string", Description: "renamed"},
+		{TomlPath: "NoFlag", KvKey: "noflag", Type: "string"},
+		{TomlPath: "Map", KvKey: "map/<key>", Flag: "--map", Type: "map[string]string", Description: "map"},
+		{TomlPath: "Slice", KvKey: "slice/<index>", Flag: "--slice", Type: "[]int", Default: "[1 2]", Description: "slice"},
+	}
+	assert.Equal(t, expected, keys)
+}
+
+func TestWriteMarkdownDocs(t *testing.T) {
+	config := &struct {
+		Version string `short:"v" description:"Version | number"`
+		Timeout parse.Duration
+	}{Version: "1.0", Timeout: parse.Duration(time.Second)}
+
+	buf := &bytes.Buffer{}
+	err := WriteMarkdownDocs(&flaeg.Command{Name: "test", Description: "description test", Config: config}, buf)
+	require.NoError(t, err)
+
+	expected := "# test\n\ndescription test\n\n" +
+		"| TOML | KV | Flag | Type | Default | Description |\n" +
+		"|------|----|------|------|---------|-------------|\n" +
+		"| `Version` | `version` | `-v, --version` | `string` | `1.0` | Version \\| number |\n" +
+		"| `Timeout` | `timeout` |  | `parse.Duration` | `1s` |  |\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriteHTMLDocs(t *testing.T) {
+	config := &struct {
+		Version string `short:"v" description:"Version <number>"`
+	}{Version: "1.0"}
+
+	buf := &bytes.Buffer{}
+	err := WriteHTMLDocs(&flaeg.Command{Name: "test", Config: config}, buf)
+	require.NoError(t, err)
+
+	expected := `<h1>test</h1>
+<table>
+<thead>
+<tr><th>TOML</th><th>KV</th><th>Flag</th><th>Type</th><th>Default</th><th>Description</th></tr>
+</thead>
+<tbody>
+<tr><td><code>Version</code></td><td><code>version</code></td><td><code>-v</code>, <code>--version</code></td><td><code>string</code></td><td><code>1.0</code></td><td>Version &lt;number&gt;</td></tr>
+</tbody>
+</table>
+`
+	assert.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,100 @@
+package staert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/containous/flaeg"
+)
+
+var _ Source = (*FileTreeSource)(nil)
+
+// FileTreeSource implements Source
+// It reads a directory tree where each file path below the root is a key and the file content is the value,
+// like mounted Kubernetes ConfigMaps or Docker secrets :
+// File : "<root>/<fieldNameLevel1>/<fieldNameLevel2>/.../<fieldName>" -> Value
+// The keys are decoded as KvSource ones.
+type FileTreeSource struct {
+	root string
+}
+
+// NewFileTreeSource creates and return a pointer on FileTreeSource
+// The source is empty if the root directory doesn't exist
+func NewFileTreeSource(root string) *FileTreeSource {
+	return &FileTreeSource{root: root}
+}
+
+// Parse loads the directory tree into the command config
+func (fts *FileTreeSource) Parse(cmd *flaeg.Command) (*flaeg.Command, error) {
+	err := fts.LoadConfig(cmd.Config)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// LoadConfig loads the directory tree into the config structure (given by reference)
+func (fts *FileTreeSource) LoadConfig(config interface{}) error {
+	pairs := make(map[string][]byte)
+	root, err := preProcessDir(fts.root)
+	if err != nil {
+		return err
+	}
+	if err := readFileTree(root, "", pairs); err != nil {
+		return err
+	}
+	return decodePairs(pairs, "", config)
+}
+
+// readFileTree reads the files under dir into pairs, the keys being prefixed by key
+// Symbolic links are followed, the entries starting with ".." (Kubernetes internal directories) are ignored
+// and a trailing new line is removed from the values
+func readFileTree(dir string, key string, pairs map[string][]byte) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "..") {
+			continue
+		}
+		fullPath := filepath.Join(dir, entry.Name())
+		entryKey := path.Join(key, entry.Name())
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			entry, err = os.Stat(fullPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if entry.IsDir() {
+			if err := readFileTree(fullPath, entryKey, pairs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return err
+		}
+		if bytes.HasSuffix(value, []byte("\r\n")) {
+			value = bytes.TrimSuffix(value, []byte("\r\n"))
+		} else {
+			value = bytes.TrimSuffix(value, []byte("\n"))
+		}
+		if len(value) > 0 {
+			pairs[entryKey] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package staert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containous/flaeg"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTreeSource_Parse(t *testing.T) {
+	src := NewFileTreeSource("./fixtures/filetree")
+
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	command, err := src.Parse(cmd)
+	require.NoError(t, err)
+	assert.Exactly(t, cmd, command)
+
+	expected := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:    28,
+			S1String: "S1StringFileTree",
+			S1PtrStruct3: &Struct3{
+				S3Float64: 28.28,
+			},
+		},
+		DurationField: parse.Duration(28 * time.Second),
+	}
+
+	assert.Exactly(t, expected, command.Config)
+}
+
+func TestFileTreeSource_LoadConfig_NotFound(t *testing.T) {
+	src := NewFileTreeSource("/any/other/path")
+
+	config := &StructPtr{
+		DurationField: parse.Duration(time.Second),
+	}
+	err := src.LoadConfig(config)
+	require.NoError(t, err)
+
+	expected := &StructPtr{
+		DurationField: parse.Duration(time.Second),
+	}
+	assert.Exactly(t, expected, config)
+}
+
+func TestFileTreeSource_LoadConfig_ConfigMap(t *testing.T) {
+	// Kubernetes ConfigMap layout :
+	// <root>/..2018_01_01_00_00_00.0000/<files>
+	// <root>/..data -> ..2018_01_01_00_00_00.0000
+	// <root>/<file> -> ..data/<file>
+	root, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	dataDir := filepath.Join(root, "..2018_01_01_00_00_00.0000")
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "vmap"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDir, "vfoo"), []byte("toto\r\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDir, "vmap", "k1"), []byte("v1\n"), 0644))
+	require.NoError(t, os.Symlink(dataDir, filepath.Join(root, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "vfoo"), filepath.Join(root, "vfoo")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "vmap"), filepath.Join(root, "vmap")))
+
+	config := &struct {
+		Vfoo string
+		Vmap map[string]string
+	}{}
+	err = NewFileTreeSource(root).LoadConfig(config)
+	require.NoError(t, err)
+
+	assert.Equal(t, "toto", config.Vfoo)
+	assert.Equal(t, map[string]string{"k1": "v1"}, config.Vmap)
+}
@@ -0,0 +1,160 @@
+package staert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/containous/flaeg"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Document formats decoded by the sources
+const (
+	FormatToml = "toml"
+	FormatJSON = "json"
+	FormatYaml = "yaml"
+)
+
+// FileExtensions are the extensions of the formats decoded by TomlSource, to set its Extensions
+var FileExtensions = []string{".toml", ".tml", ".yaml", ".yml", ".json"}
+
+// formatFromExtension returns the format of a document from its extension (like ".json"), "" if unknown
+func formatFromExtension(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".toml", ".tml":
+		return FormatToml
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYaml
+	default:
+		return ""
+	}
+}
+
+// formatFromContentType returns the format of a document from its media type, "" if unknown
+func formatFromContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "application/toml", "text/toml", "text/x-toml":
+		return FormatToml
+	case "application/json", "text/json":
+		return FormatJSON
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return FormatYaml
+	default:
+		return ""
+	}
+}
+
+// convertToToml converts the document data of the format to TOML, to decode it like TomlSource does
+// Null values are omitted, TOML having none
+func convertToToml(format string, data []byte) ([]byte, error) {
+	tree := make(map[string]interface{})
+	switch format {
+	case FormatToml:
+		return data, nil
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		// keep the integers as integers
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return nil, err
+		}
+	case FormatYaml:
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown document format %q", format)
+	}
+
+	value, err := tomlDocumentValue(tree)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if value == nil {
+		return buf.Bytes(), nil
+	}
+	if err := toml.NewEncoder(buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tomlDocumentValue converts a value decoded from JSON or YAML into a TOML one, nil if it must be omitted
+func tomlDocumentValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case int:
+		return int64(v), nil
+	case map[string]interface{}, map[interface{}]interface{}:
+		return tomlDocumentTree(reflect.ValueOf(v))
+	case []interface{}:
+		var list []interface{}
+		for _, child := range v {
+			converted, err := tomlDocumentValue(child)
+			if err != nil {
+				return nil, err
+			}
+			if converted != nil {
+				list = append(list, converted)
+			}
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
+// tomlDocumentTree converts a JSON or YAML map into a TOML table, YAML keys may be of any type
+func tomlDocumentTree(mapValue reflect.Value) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	for _, key := range mapValue.MapKeys() {
+		converted, err := tomlDocumentValue(mapValue.MapIndex(key).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if converted != nil {
+			tree[fmt.Sprint(key.Interface())] = converted
+		}
+	}
+	return tree, nil
+}
+
+// parseConvertedToml decodes the TOML document data, converted from the document of another format of file,
+// into the command config like parseToml does
+// The errors and the keys are located by file only, the lines of the TOML document not being the ones of the document
+func parseConvertedToml(cmd *flaeg.Command, file string, data []byte, rewrite treeRewriter) (*flaeg.Command, error) {
+	if rewrite != nil {
+		rewriteTree := rewrite
+		rewrite = func(raw *rawTree) (bool, error) {
+			raw.location = func([]string) string { return file }
+			return rewriteTree(raw)
+		}
+	}
+
+	_, err := parseToml(cmd, file, data, rewrite)
+	if tomlErr, ok := err.(*TomlError); ok {
+		tomlErr.Line, tomlErr.Column = 0, 0
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
@@ -0,0 +1,93 @@
+package staert
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_convertToToml(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		format   string
+		document string
+	}{
+		{
+			desc:   "TOML",
+			format: FormatToml,
+			document: `
+DurationField = 28
+[PtrStruct1]
+S1Int = 28
+S1String = "S1StringHTTP"
+[[List]]
+Name = "a"
+`,
+		},
+		{
+			desc:     "JSON",
+			format:   FormatJSON,
+			document: `{"DurationField": 28, "PtrStruct1": {"S1Int": 28, "S1String": "S1StringHTTP", "S1Null": null}, "List": [{"Name": "a"}]}`,
+		},
+		{
+			desc:   "YAML",
+			format: FormatYaml,
+			document: `
+DurationField: 28
+PtrStruct1:
+  S1Int: 28
+  S1String: S1StringHTTP
+  S1Null:
+List:
+  - Name: a
+`,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := convertToToml(test.format, []byte(test.document))
+			require.NoError(t, err)
+
+			tree := make(map[string]interface{})
+			_, err = toml.Decode(string(data), &tree)
+			require.NoError(t, err)
+
+			expected := map[string]interface{}{
+				"DurationField": int64(28),
+				"PtrStruct1": map[string]interface{}{
+					"S1Int":    int64(28),
+					"S1String": "S1StringHTTP",
+				},
+				"List": []map[string]interface{}{
+					{"Name": "a"},
+				},
+			}
+			assert.Equal(t, expected, tree)
+		})
+	}
+}
+
+func Test_convertToToml_errors(t *testing.T) {
+	_, err := convertToToml(FormatJSON, []byte(`{"S1Int": `))
+	assert.Error(t, err)
+
+	_, err = convertToToml(FormatYaml, []byte("- a\n- b"))
+	assert.Error(t, err)
+
+	_, err = convertToToml("xml", []byte("<a/>"))
+	assert.EqualError(t, err, `unknown document format "xml"`)
+}
+
+func Test_formatFromContentType(t *testing.T) {
+	assert.Equal(t, FormatJSON, formatFromContentType("application/json; charset=utf-8"))
+	assert.Equal(t, FormatYaml, formatFromContentType("application/x-yaml"))
+	assert.Equal(t, FormatToml, formatFromContentType("application/toml"))
+	assert.Equal(t, "", formatFromContentType("text/plain"))
+	assert.Equal(t, "", formatFromContentType(""))
+}
@@ -0,0 +1,169 @@
+package staert
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// The history of the configurations stored by StoreConfigVersion is kept under Prefix like this :
+// Key : "<prefix>/_history/<version>/..." -> Value
+// Key : "<prefix>/_history/active" -> active version
+const (
+	historyDir       = "_history"
+	activeVersionKey = "active"
+)
+
+// StoreConfigVersion stores the config as a new version in the history, makes it the active version
+// and synchronises the keys under Prefix with it (see SyncConfig)
+// It returns the new version number
+func (kv *KvSource) StoreConfigVersion(config interface{}) (int, error) {
+	kvMap, err := collateKvUnderPrefix(config, kv.Prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	versions, err := kv.ListVersions()
+	if err != nil {
+		return 0, err
+	}
+	version := 1
+	if len(versions) > 0 {
+		version = versions[len(versions)-1] + 1
+	}
+
+	versionPrefix := kv.versionPrefix(version)
+	// the directory keeps track of versions without any key
+	if err := kv.Put(versionPrefix+"/", nil, writeOptions(versionPrefix+"/")); err != nil {
+		return 0, err
+	}
+	for k, v := range rebaseKeys(kvMap, kv.Prefix, versionPrefix) {
+		if err := kv.Put(k, []byte(v), writeOptions(k)); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, kv.activateVersion(version, kvMap)
+}
+
+// ListVersions returns the versions stored in the history, in ascending order
+func (kv *KvSource) ListVersions() ([]int, error) {
+	keys, err := kv.listKeysWithPrefix(kv.historyPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[int]bool{}
+	for key := range keys {
+		name := strings.SplitN(strings.TrimPrefix(key, kv.historyPrefix()+"/"), "/", 2)[0]
+		if version, err := strconv.Atoi(name); err == nil {
+			found[version] = true
+		}
+	}
+
+	versions := make([]int, 0, len(found))
+	for version := range found {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// ActiveVersion returns the active version, 0 if no version has been stored yet
+func (kv *KvSource) ActiveVersion() (int, error) {
+	pair, err := kv.Get(kv.historyPrefix()+"/"+activeVersionKey, nil)
+	if err != nil || pair == nil {
+		return 0, ignoreKeyNotFound(err)
+	}
+	return strconv.Atoi(string(pair.Value))
+}
+
+// DiffVersions returns the changes to apply on the version from to get the version to
+// Keys are named as under Prefix
+func (kv *KvSource) DiffVersions(from, to int) ([]KeyChange, error) {
+	fromKv, err := kv.loadVersion(from)
+	if err != nil {
+		return nil, err
+	}
+	toKv, err := kv.loadVersion(to)
+	if err != nil {
+		return nil, err
+	}
+	return diffKv(fromKv, toKv), nil
+}
+
+// Rollback makes version the active version and synchronises the keys under Prefix with it
+func (kv *KvSource) Rollback(version int) error {
+	kvMap, err := kv.loadVersion(version)
+	if err != nil {
+		return err
+	}
+	return kv.activateVersion(version, kvMap)
+}
+
+func (kv *KvSource) activateVersion(version int, kvMap map[string]string) error {
+	if _, err := kv.syncKvMap(kvMap, false); err != nil {
+		return err
+	}
+	return kv.Put(kv.historyPrefix()+"/"+activeVersionKey, []byte(strconv.Itoa(version)), nil)
+}
+
+// loadVersion returns the keys of a version, named as under Prefix
+func (kv *KvSource) loadVersion(version int) (map[string]string, error) {
+	versions, err := kv.ListVersions()
+	if err != nil {
+		return nil, err
+	}
+	if i := sort.SearchInts(versions, version); i == len(versions) || versions[i] != version {
+		return nil, fmt.Errorf("version %d not found", version)
+	}
+
+	keys, err := kv.listKeysWithPrefix(kv.versionPrefix(version))
+	if err != nil {
+		return nil, err
+	}
+	return rebaseKeys(keys, kv.versionPrefix(version), kv.Prefix), nil
+}
+
+func (kv *KvSource) historyPrefix() string {
+	return joinKey(strings.Trim(kv.Prefix, "/"), "/", historyDir)
+}
+
+func (kv *KvSource) versionPrefix(version int) string {
+	return kv.historyPrefix() + "/" + strconv.Itoa(version)
+}
+
+func (kv *KvSource) isHistoryKey(key string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(key, "/"), kv.historyPrefix()+"/")
+}
+
+// isReservedKey returns true for the keys written by staert which aren't configuration keys
+// The lock key is only under Prefix when Prefix is empty
+func (kv *KvSource) isReservedKey(key string) bool {
+	return kv.isHistoryKey(key) || strings.TrimPrefix(key, "/") == lockKey(kv.Prefix)
+}
+
+// rebaseKeys moves the keys from the prefix from to the prefix to
+func rebaseKeys(kvMap map[string]string, from, to string) map[string]string {
+	from = strings.Trim(from, "/")
+	to = strings.Trim(to, "/")
+	rebased := make(map[string]string, len(kvMap))
+	for k, v := range kvMap {
+		key := strings.TrimPrefix(k, "/")
+		if len(from) > 0 {
+			key = strings.TrimPrefix(key, from+"/")
+		}
+		rebased[joinKey(to, "/", key)] = v
+	}
+	return rebased
+}
+
+func ignoreKeyNotFound(err error) error {
+	if err == store.ErrKeyNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package staert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type HistoryStruct struct {
+	Vfoo string
+	Vmap map[string]string
+}
+
+func TestStoreConfigVersion(t *testing.T) {
+	kv := &KvSource{&Mock{}, "prefix"}
+
+	version, err := kv.StoreConfigVersion(&HistoryStruct{
+		Vfoo: "toto",
+		Vmap: map[string]string{"k1": "v1", "k2": "v2"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	version, err = kv.StoreConfigVersion(&HistoryStruct{
+		Vfoo: "tata",
+		Vmap: map[string]string{"k1": "v1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	versions, err := kv.ListVersions()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	active, err := kv.ActiveVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 2, active)
+
+	config := &HistoryStruct{}
+	err = kv.LoadConfig(config)
+	require.NoError(t, err)
+
+	expected := &HistoryStruct{
+		Vfoo: "tata",
+		Vmap: map[string]string{"k1": "v1"},
+	}
+	assert.Equal(t, expected, config)
+
+	pair, err := kv.Get("prefix/_history/1/vmap/k2", nil)
+	require.NoError(t, err)
+	require.NotNil(t, pair)
+	assert.Equal(t, "v2", string(pair.Value))
+}
+
+func TestDiffVersions(t *testing.T) {
+	kv := &KvSource{&Mock{}, "prefix"}
+
+	_, err := kv.StoreConfigVersion(&HistoryStruct{
+		Vfoo: "toto",
+		Vmap: map[string]string{"k1": "v1", "k2": "v2"},
+	})
+	require.NoError(t, err)
+	_, err = kv.StoreConfigVersion(&HistoryStruct{
+		Vfoo: "tata",
+		Vmap: map[string]string{"k1": "v1", "k3": "v3"},
+	})
+	require.NoError(t, err)
+
+	changes, err := kv.DiffVersions(1, 2)
+	require.NoError(t, err)
+
+	expected := []KeyChange{
+		{Key: "prefix/vfoo", Type: KeyModified, OldValue: "toto", NewValue: "tata"},
+		{Key: "prefix/vmap/k2", Type: KeyRemoved, OldValue: "v2"},
+		{Key: "prefix/vmap/k3", Type: KeyAdded, NewValue: "v3"},
+	}
+	assert.Equal(t, expected, changes)
+
+	_, err = kv.DiffVersions(1, 3)
+	assert.EqualError(t, err, "version 3 not found")
+}
+
+func TestRollback(t *testing.T) {
+	kv := &KvSource{&Mock{}, "prefix"}
+
+	_, err := kv.StoreConfigVersion(&HistoryStruct{
+		Vfoo: "toto",
+		Vmap: map[string]string{"k1": "v1"},
+	})
+	require.NoError(t, err)
+	_, err = kv.StoreConfigVersion(&HistoryStruct{
+		Vfoo: "tata",
+		Vmap: map[string]string{"k2": "v2"},
+	})
+	require.NoError(t, err)
+
+	err = kv.Rollback(1)
+	require.NoError(t, err)
+
+	active, err := kv.ActiveVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 1, active)
+
+	config := &HistoryStruct{}
+	err = kv.LoadConfig(config)
+	require.NoError(t, err)
+
+	expected := &HistoryStruct{
+		Vfoo: "toto",
+		Vmap: map[string]string{"k1": "v1"},
+	}
+	assert.Equal(t, expected, config)
+
+	versions, err := kv.ListVersions()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+}
+
+func TestConfigVersionsEmptyPrefix(t *testing.T) {
+	mock := &Mock{}
+	kv := &KvSource{mock, ""}
+
+	_, err := kv.StoreConfigVersion(&HistoryStruct{
+		Vfoo: "toto",
+		Vmap: map[string]string{"k1": "v1"},
+	})
+	require.NoError(t, err)
+	_, err = kv.StoreConfigVersion(&HistoryStruct{
+		Vfoo: "tata",
+		Vmap: map[string]string{"k2": "v2"},
+	})
+	require.NoError(t, err)
+
+	pair, err := kv.Get("_history/1/vfoo", nil)
+	require.NoError(t, err)
+	require.NotNil(t, pair)
+	assert.Equal(t, "toto", string(pair.Value))
+
+	changes, err := kv.DiffVersions(1, 2)
+	require.NoError(t, err)
+
+	expected := []KeyChange{
+		{Key: "vfoo", Type: KeyModified, OldValue: "toto", NewValue: "tata"},
+		{Key: "vmap/k1", Type: KeyRemoved, OldValue: "v1"},
+		{Key: "vmap/k2", Type: KeyAdded, NewValue: "v2"},
+	}
+	assert.Equal(t, expected, changes)
+
+	err = kv.Rollback(1)
+	require.NoError(t, err)
+
+	config := &HistoryStruct{}
+	err = kv.LoadConfig(config)
+	require.NoError(t, err)
+
+	expectedConfig := &HistoryStruct{
+		Vfoo: "toto",
+		Vmap: map[string]string{"k1": "v1"},
+	}
+	assert.Equal(t, expectedConfig, config)
+
+	versions, err := kv.ListVersions()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+}
+
+func TestActiveVersionEmpty(t *testing.T) {
+	kv := &KvSource{&Mock{}, "prefix"}
+
+	active, err := kv.ActiveVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 0, active)
+
+	versions, err := kv.ListVersions()
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+}
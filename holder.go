@@ -0,0 +1,89 @@
+package staert
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Holder holds the current config, to share it between goroutines while it is reloaded
+// Get is lock-free, the config returned must not be modified: Set or Reload replace it by a new one
+type Holder struct {
+	config atomic.Value
+
+	lock        sync.Mutex
+	subscribers map[chan interface{}]struct{}
+
+	reload sync.Mutex // serialises the reloads, so that none is based on an outdated config
+}
+
+// heldConfig wraps the configs, as atomic.Value requires values of the same type
+type heldConfig struct {
+	config interface{}
+}
+
+// NewHolder creates and return a pointer on Holder, holding config
+func NewHolder(config interface{}) *Holder {
+	h := &Holder{subscribers: make(map[chan interface{}]struct{})}
+	h.config.Store(heldConfig{config})
+	return h
+}
+
+// Get returns the current config
+func (h *Holder) Get() interface{} {
+	return h.config.Load().(heldConfig).config
+}
+
+// Set replaces the current config and notifies the subscribers
+func (h *Holder) Set(config interface{}) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.config.Store(heldConfig{config})
+	for subscriber := range h.subscribers {
+		// only the last config is kept for slow subscribers
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- config
+	}
+}
+
+// Subscribe returns a channel receiving the new configs, and a func to unsubscribe which closes it
+// A subscriber which doesn't receive a config before the next one only receives the last one
+func (h *Holder) Subscribe() (<-chan interface{}, func()) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	subscriber := make(chan interface{}, 1)
+	h.subscribers[subscriber] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.lock.Lock()
+			defer h.lock.Unlock()
+
+			delete(h.subscribers, subscriber)
+			close(subscriber)
+		})
+	}
+	return subscriber, unsubscribe
+}
+
+// Reload reloads the config with the Reload of s and, if it succeeds and the config changed, sets it as the current config
+// The new config is loaded into a copy: the configs returned by Get are never modified.
+// It returns the report of the reload, which tells if some applied changes require a restart
+func (h *Holder) Reload(s *Staert) (*ReloadReport, error) {
+	h.reload.Lock()
+	defer h.reload.Unlock()
+
+	report, err := s.Reload(h.Get())
+	if err != nil {
+		return report, err
+	}
+	if len(report.Live) > 0 || len(report.Restart) > 0 {
+		h.Set(report.Config)
+	}
+	return report, nil
+}
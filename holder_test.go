@@ -0,0 +1,170 @@
+package staert
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containous/flaeg"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHolder(t *testing.T) {
+	config1 := &StructPtr{DurationField: parse.Duration(time.Second)}
+	config2 := &StructPtr{DurationField: parse.Duration(2 * time.Second)}
+	config3 := &StructPtr{DurationField: parse.Duration(3 * time.Second)}
+
+	h := NewHolder(config1)
+	assert.Equal(t, config1, h.Get())
+
+	configs, unsubscribe := h.Subscribe()
+
+	h.Set(config2)
+	assert.Equal(t, config2, h.Get())
+	assert.Equal(t, config2, <-configs)
+
+	// only the last config is received
+	h.Set(config1)
+	h.Set(config3)
+	assert.Equal(t, config3, <-configs)
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-configs
+	assert.False(t, ok)
+
+	h.Set(config1)
+	assert.Equal(t, config1, h.Get())
+}
+
+func TestHolder_concurrentGet(t *testing.T) {
+	h := NewHolder(&StructPtr{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.NotNil(t, h.Get().(*StructPtr))
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		h.Set(&StructPtr{DurationField: parse.Duration(i)})
+	}
+	wg.Wait()
+}
+
+func TestHolder_Reload(t *testing.T) {
+	rootCmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	s := NewStaert(rootCmd)
+	s.AddSource(NewTomlSource("trivial", []string{"./fixtures/"}))
+
+	initial := &StructPtr{}
+	h := NewHolder(initial)
+	configs, unsubscribe := h.Subscribe()
+	defer unsubscribe()
+
+	report, err := h.Reload(s)
+	require.NoError(t, err)
+	assert.NotEmpty(t, report.Live)
+
+	config := h.Get().(*StructPtr)
+	assert.Equal(t, 28, config.PtrStruct1.S1Int)
+	assert.Equal(t, config, <-configs)
+
+	// an unchanged config is not set
+	report, err = h.Reload(s)
+	require.NoError(t, err)
+	assert.Empty(t, report.Live)
+	assert.True(t, config == h.Get())
+	select {
+	case <-configs:
+		t.Fatal("unexpected notification")
+	default:
+	}
+
+	s.AddSource(&ErrorSource{})
+	_, err = h.Reload(s)
+	assert.Error(t, err)
+	assert.True(t, config == h.Get())
+}
+
+func TestHolder_ReloadConcurrentGet(t *testing.T) {
+	rootCmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	memory := NewMemoryStore()
+	require.NoError(t, memory.Put("prefix/ptrstruct1/s1int", []byte("0"), nil))
+
+	s := NewStaert(rootCmd)
+	s.AddSource(&KvSource{memory, "prefix"})
+
+	_, err := s.LoadConfig()
+	require.NoError(t, err)
+	h := NewHolder(rootCmd.Config)
+	initial := deepCopy(h.Get())
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// the held configs are only read
+				config := h.Get().(*StructPtr)
+				assert.NotNil(t, config.PtrStruct1)
+				_ = config.PtrStruct1.S1Int
+			}
+		}()
+	}
+
+	held := h.Get()
+	var reloads sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		reloads.Add(1)
+		go func() {
+			defer reloads.Done()
+			for j := 1; j <= 20; j++ {
+				_, err := h.Reload(s)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	for j := 1; j <= 20; j++ {
+		require.NoError(t, memory.Put("prefix/ptrstruct1/s1int", []byte(strconv.Itoa(j)), nil))
+	}
+	reloads.Wait()
+	close(done)
+	wg.Wait()
+
+	_, err = h.Reload(s)
+	require.NoError(t, err)
+	assert.Equal(t, 20, h.Get().(*StructPtr).PtrStruct1.S1Int)
+	// the config held before the reloads is untouched
+	assert.Equal(t, initial, held)
+}
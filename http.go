@@ -0,0 +1,293 @@
+package staert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/containous/flaeg"
+)
+
+var _ Source = (*HTTPSource)(nil)
+
+// HTTPOptions are the options of HTTPSource
+type HTTPOptions struct {
+	Format      string // FormatToml, FormatJSON or FormatYaml, found from the Content-Type or the URL extension if empty
+	BearerToken string
+	Username    string // basic auth, if not empty
+	Password    string
+	TLS         *tls.Config   // base TLS configuration, completed by the files below
+	CertFile    string        // client certificate
+	KeyFile     string        // client certificate key
+	CACertFile  string        // CA of the server certificate, the system ones if empty
+	Timeout     time.Duration // timeout of a request, DefaultHTTPTimeout if 0
+	CacheFile   string        // TOML copy of the last document fetched, loaded when the server is unreachable
+}
+
+// DefaultHTTPTimeout is the timeout of the HTTPSource requests if HTTPOptions.Timeout is 0
+const DefaultHTTPTimeout = 30 * time.Second
+
+// HTTPSource implements Source
+// It fetches a TOML, JSON or YAML document from an URL and decodes it as TomlSource does.
+// The document is fetched again only if it changed (ETag and Last-Modified), and the last one fetched
+// is used if the server is unreachable or fails.
+type HTTPSource struct {
+	url     string
+	options HTTPOptions
+	client  *http.Client
+
+	lock         sync.Mutex
+	etag         string
+	lastModified string
+	data         []byte // last document fetched, converted to TOML
+	converted    bool   // true if the last document fetched was not a TOML document
+	fromCache    bool
+}
+
+// NewHTTPSource creates and return a pointer on HTTPSource, options may be nil
+func NewHTTPSource(rawURL string, options *HTTPOptions) (*HTTPSource, error) {
+	if _, err := url.Parse(rawURL); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &HTTPOptions{}
+	}
+
+	tlsConfig, err := httpTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeout
+	}
+
+	return &HTTPSource{
+		url:     rawURL,
+		options: *options,
+		client:  &http.Client{Timeout: timeout, Transport: newHTTPTransport(tlsConfig)},
+	}, nil
+}
+
+// newHTTPTransport returns a transport with the settings of http.DefaultTransport, using tlsConfig
+func newHTTPTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+}
+
+// httpTLSConfig returns the TLS configuration of the options, nil to use the default one
+func httpTLSConfig(options *HTTPOptions) (*tls.Config, error) {
+	if options.TLS == nil && len(options.CertFile) == 0 && len(options.CACertFile) == 0 {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if options.TLS != nil {
+		tlsConfig = options.TLS.Clone()
+	}
+	if len(options.CertFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	if len(options.CACertFile) > 0 {
+		caCert, err := ioutil.ReadFile(options.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %s", options.CACertFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// FromCache returns true if the last Parse used the last document fetched, the server being unreachable
+func (hs *HTTPSource) FromCache() bool {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	return hs.fromCache
+}
+
+// Parse fetches the document and decodes it into the command config
+func (hs *HTTPSource) Parse(cmd *flaeg.Command) (*flaeg.Command, error) {
+	return hs.parseRewritten(cmd, nil)
+}
+
+// parseRewritten parses the document like Parse, rewriting the raw key tree with rewrite before decoding it
+func (hs *HTTPSource) parseRewritten(cmd *flaeg.Command, rewrite treeRewriter) (*flaeg.Command, error) {
+	data, converted, err := hs.fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	if rewrite != nil {
+		rewriteTree := rewrite
+		rewrite = func(raw *rawTree) (bool, error) {
+			raw.source = "http"
+			return rewriteTree(raw)
+		}
+	}
+
+	if converted {
+		return parseConvertedToml(cmd, hs.url, data, rewrite)
+	}
+	return parseToml(cmd, hs.url, data, rewrite)
+}
+
+// fetch returns the document converted to TOML, and true if it was not a TOML document
+func (hs *HTTPSource) fetch() ([]byte, bool, error) {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	data, converted, err := hs.get()
+	if err == nil {
+		hs.fromCache = false
+		return data, converted, nil
+	}
+	if _, unreachable := err.(*unreachableError); !unreachable {
+		return nil, false, err
+	}
+
+	hs.fromCache = true
+	if hs.data != nil {
+		return hs.data, hs.converted, nil
+	}
+	if len(hs.options.CacheFile) > 0 {
+		if data, cacheErr := ioutil.ReadFile(hs.options.CacheFile); cacheErr == nil {
+			return data, true, nil
+		}
+	}
+	hs.fromCache = false
+	return nil, false, err
+}
+
+// unreachableError is an error of the server or of the connection to it, the last document fetched can be used
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return e.err.Error()
+}
+
+// get gets the document if it changed since the last one fetched, converted to TOML, and true if it was not a TOML document
+// The document is kept for the next requests (and written to the CacheFile) only if it is valid
+func (hs *HTTPSource) get() ([]byte, bool, error) {
+	req, err := hs.newRequest()
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return nil, false, &unreachableError{err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hs.data != nil:
+		return hs.data, hs.converted, nil
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, false, &unreachableError{fmt.Errorf("%s: %s", hs.url, resp.Status)}
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("%s: %s", hs.url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, &unreachableError{err}
+	}
+
+	format := hs.documentFormat(resp.Header.Get("Content-Type"), req.URL.Path)
+	data, err := convertToToml(format, body)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: invalid %s document: %v", hs.url, format, err)
+	}
+	converted := format != FormatToml
+	if !converted {
+		if _, err := toml.Decode(string(data), &map[string]interface{}{}); err != nil {
+			// the error is located when decoding the document into the config
+			return data, false, nil
+		}
+	}
+
+	if err := hs.keep(data, converted, resp.Header); err != nil {
+		return nil, false, err
+	}
+	return data, converted, nil
+}
+
+// keep keeps the document for the next requests, and writes it to the CacheFile
+func (hs *HTTPSource) keep(data []byte, converted bool, header http.Header) error {
+	if len(hs.options.CacheFile) > 0 {
+		if err := ioutil.WriteFile(hs.options.CacheFile, data, 0600); err != nil {
+			return err
+		}
+	}
+	hs.data = data
+	hs.converted = converted
+	hs.etag = header.Get("ETag")
+	hs.lastModified = header.Get("Last-Modified")
+	return nil
+}
+
+func (hs *HTTPSource) newRequest() (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, hs.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/toml, application/json, application/yaml;q=0.9, */*;q=0.8")
+	if len(hs.options.BearerToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+hs.options.BearerToken)
+	} else if len(hs.options.Username) > 0 {
+		req.SetBasicAuth(hs.options.Username, hs.options.Password)
+	}
+	if hs.data != nil {
+		if len(hs.etag) > 0 {
+			req.Header.Set("If-None-Match", hs.etag)
+		}
+		if len(hs.lastModified) > 0 {
+			req.Header.Set("If-Modified-Since", hs.lastModified)
+		}
+	}
+	return req, nil
+}
+
+// documentFormat returns the Format option, or the format given by the content type or by the extension of the URL path,
+// TOML by default
+func (hs *HTTPSource) documentFormat(contentType string, urlPath string) string {
+	if len(hs.options.Format) > 0 {
+		return hs.options.Format
+	}
+	if format := formatFromContentType(contentType); len(format) > 0 {
+		return format
+	}
+	if format := formatFromExtension(path.Ext(urlPath)); len(format) > 0 {
+		return format
+	}
+	return FormatToml
+}
@@ -0,0 +1,466 @@
+package staert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containous/flaeg"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHTTPCommand() *flaeg.Command {
+	return &flaeg.Command{
+		Name:                  "test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+}
+
+func serveDocument(contentType string, document string) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if len(contentType) > 0 {
+			rw.Header().Set("Content-Type", contentType)
+		}
+		rw.Write([]byte(document))
+	}
+}
+
+func TestNewHTTPSource_timeout(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		options  *HTTPOptions
+		expected time.Duration
+	}{
+		{desc: "no options", expected: DefaultHTTPTimeout},
+		{desc: "no timeout", options: &HTTPOptions{}, expected: DefaultHTTPTimeout},
+		{desc: "timeout", options: &HTTPOptions{Timeout: time.Second}, expected: time.Second},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			hs, err := NewHTTPSource("http://localhost/config.toml", test.options)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, hs.client.Timeout)
+			transport, ok := hs.client.Transport.(*http.Transport)
+			require.True(t, ok)
+			assert.NotNil(t, transport.Proxy)
+			assert.NotNil(t, transport.DialContext)
+			assert.NotZero(t, transport.TLSHandshakeTimeout)
+			assert.NotZero(t, transport.IdleConnTimeout)
+		})
+	}
+}
+
+func TestHTTPSource_Parse_timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	hs, err := NewHTTPSource(server.URL+"/config.toml", &HTTPOptions{Timeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+
+	_, err = hs.Parse(newHTTPCommand())
+	assert.Error(t, err)
+}
+
+func TestHTTPSource_Parse(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		path        string
+		contentType string
+		format      string
+		document    string
+	}{
+		{
+			desc:     "TOML",
+			path:     "/config",
+			document: "DurationField = 28\n[PtrStruct1]\nS1Int = 28\n",
+		},
+		{
+			desc:        "JSON content type",
+			path:        "/config",
+			contentType: "application/json",
+			document:    `{"DurationField": 28, "PtrStruct1": {"S1Int": 28}}`,
+		},
+		{
+			desc:     "YAML extension",
+			path:     "/config.yml",
+			document: "DurationField: 28\nPtrStruct1:\n  S1Int: 28\n",
+		},
+		{
+			desc:        "JSON format option",
+			path:        "/config",
+			contentType: "text/plain",
+			format:      FormatJSON,
+			document:    `{"DurationField": 28, "PtrStruct1": {"S1Int": 28}}`,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(serveDocument(test.contentType, test.document))
+			defer server.Close()
+
+			src, err := NewHTTPSource(server.URL+test.path, &HTTPOptions{Format: test.format})
+			require.NoError(t, err)
+
+			cmd, err := src.Parse(newHTTPCommand())
+			require.NoError(t, err)
+
+			expected := &StructPtr{
+				PtrStruct1: &Struct1{
+					S1Int:    28,
+					S1String: "S1StringDefaultPointersConfig",
+					S1Bool:   true,
+				},
+				DurationField: parse.Duration(28 * time.Second),
+			}
+			assert.Equal(t, expected, cmd.Config)
+		})
+	}
+}
+
+func TestHTTPSource_Parse_notModified(t *testing.T) {
+	lastModified := time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("If-None-Match") == `"v1"` && req.Header.Get("If-Modified-Since") == lastModified {
+			notModified++
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.Header().Set("ETag", `"v1"`)
+		rw.Header().Set("Last-Modified", lastModified)
+		rw.Write([]byte("[PtrStruct1]\nS1Int = 28\n"))
+	}))
+	defer server.Close()
+
+	src, err := NewHTTPSource(server.URL, nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		cmd, err := src.Parse(newHTTPCommand())
+		require.NoError(t, err)
+		assert.Equal(t, 28, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+		assert.False(t, src.FromCache())
+	}
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, notModified)
+}
+
+func TestHTTPSource_Parse_auth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		username, password, ok := req.BasicAuth()
+		if req.Header.Get("Authorization") != "Bearer token" && (!ok || username != "user" || password != "pass") {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rw.Write([]byte("[PtrStruct1]\nS1Int = 28\n"))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		desc     string
+		options  *HTTPOptions
+		expected string
+	}{
+		{
+			desc:    "bearer token",
+			options: &HTTPOptions{BearerToken: "token"},
+		},
+		{
+			desc:    "basic auth",
+			options: &HTTPOptions{Username: "user", Password: "pass"},
+		},
+		{
+			desc:     "wrong password",
+			options:  &HTTPOptions{Username: "user", Password: "wrong"},
+			expected: server.URL + ": 401 Unauthorized",
+		},
+		{
+			desc:     "no credentials",
+			expected: server.URL + ": 401 Unauthorized",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			src, err := NewHTTPSource(server.URL, test.options)
+			require.NoError(t, err)
+
+			_, err = src.Parse(newHTTPCommand())
+			if len(test.expected) > 0 {
+				assert.EqualError(t, err, test.expected)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHTTPSource_Parse_clientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+
+	server := httptest.NewUnstartedServer(serveDocument("", "[PtrStruct1]\nS1Int = 28\n"))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	// the handshake without client certificate fails
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	caCertFile := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(caCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	require.NoError(t, err)
+
+	src, err := NewHTTPSource(server.URL, &HTTPOptions{CertFile: certFile, KeyFile: keyFile, CACertFile: caCertFile})
+	require.NoError(t, err)
+
+	cmd, err := src.Parse(newHTTPCommand())
+	require.NoError(t, err)
+	assert.Equal(t, 28, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+
+	// without client certificate
+	src, err = NewHTTPSource(server.URL, &HTTPOptions{CACertFile: caCertFile})
+	require.NoError(t, err)
+
+	_, err = src.Parse(newHTTPCommand())
+	assert.Error(t, err)
+}
+
+// writeClientCert writes a self-signed client certificate and its key in dir
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "staert"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "client.key")
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	require.NoError(t, err)
+
+	return certFile, keyFile, cert
+}
+
+func TestHTTPSource_Parse_cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cacheFile := filepath.Join(dir, "cache.toml")
+
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if failing {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"PtrStruct1": {"S1Int": 28}}`))
+	}))
+	url := server.URL
+
+	src, err := NewHTTPSource(url, &HTTPOptions{CacheFile: cacheFile})
+	require.NoError(t, err)
+
+	cmd, err := src.Parse(newHTTPCommand())
+	require.NoError(t, err)
+	assert.Equal(t, 28, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+	assert.False(t, src.FromCache())
+
+	// the server fails
+	failing = true
+	cmd, err = src.Parse(newHTTPCommand())
+	require.NoError(t, err)
+	assert.Equal(t, 28, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+	assert.True(t, src.FromCache())
+
+	// the server is unreachable, a new source loads the cache file
+	server.Close()
+	src, err = NewHTTPSource(url, &HTTPOptions{CacheFile: cacheFile})
+	require.NoError(t, err)
+
+	cmd, err = src.Parse(newHTTPCommand())
+	require.NoError(t, err)
+	assert.Equal(t, 28, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+	assert.True(t, src.FromCache())
+
+	// without cache
+	src, err = NewHTTPSource(url, nil)
+	require.NoError(t, err)
+
+	_, err = src.Parse(newHTTPCommand())
+	assert.Error(t, err)
+	assert.False(t, src.FromCache())
+}
+
+func TestHTTPSource_Parse_malformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cacheFile := filepath.Join(dir, "cache.toml")
+
+	valid := "[PtrStruct1]\nS1Int = 28\n"
+	document := valid
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if failing {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("ETag", fmt.Sprintf("%q", document))
+		rw.Write([]byte(document))
+	}))
+	defer server.Close()
+
+	src, err := NewHTTPSource(server.URL, &HTTPOptions{CacheFile: cacheFile})
+	require.NoError(t, err)
+
+	cmd, err := src.Parse(newHTTPCommand())
+	require.NoError(t, err)
+	assert.Equal(t, 28, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+
+	// the malformed document is not kept
+	document = "[PtrStruct1]\nS1Int = \n"
+	_, err = src.Parse(newHTTPCommand())
+	require.Error(t, err)
+	tomlErr, ok := err.(*TomlError)
+	require.True(t, ok)
+	assert.Equal(t, 2, tomlErr.Line)
+
+	cache, err := ioutil.ReadFile(cacheFile)
+	require.NoError(t, err)
+	assert.Equal(t, valid, string(cache))
+
+	// the server fails, the last valid document is used
+	failing = true
+	cmd, err = src.Parse(newHTTPCommand())
+	require.NoError(t, err)
+	assert.Equal(t, 28, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+	assert.True(t, src.FromCache())
+}
+
+func TestHTTPSource_Parse_errors(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		contentType string
+		document    string
+		expected    string
+	}{
+		{
+			desc:     "TOML type error",
+			document: "[PtrStruct1]\nS1String = \"a\"\nS1Int = \"a\"\n",
+			expected: ":3:1: key PtrStruct1.S1Int (field PtrStruct1.S1Int): toml: cannot load TOML value of type string into a Go integer",
+		},
+		{
+			desc:        "JSON type error",
+			contentType: "application/json",
+			document:    `{"PtrStruct1": {"S1String": "a", "S1Int": "a"}}`,
+			expected:    ": key PtrStruct1.S1Int (field PtrStruct1.S1Int): toml: cannot load TOML value of type string into a Go integer",
+		},
+		{
+			desc:        "invalid JSON",
+			contentType: "application/json",
+			document:    `{"PtrStruct1": `,
+			expected:    ": invalid json document: unexpected EOF",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(serveDocument(test.contentType, test.document))
+			defer server.Close()
+
+			src, err := NewHTTPSource(server.URL, nil)
+			require.NoError(t, err)
+
+			_, err = src.Parse(newHTTPCommand())
+			assert.EqualError(t, err, server.URL+test.expected)
+		})
+	}
+}
+
+func TestHTTPSource_Parse_keyAlias(t *testing.T) {
+	server := httptest.NewServer(serveDocument("application/json", `{"PtrStruct1": {"OldInt": 28}}`))
+	defer server.Close()
+
+	src, err := NewHTTPSource(server.URL, nil)
+	require.NoError(t, err)
+
+	s := NewStaert(newHTTPCommand())
+	s.AddSource(src)
+	s.AddKeyAlias("PtrStruct1.OldInt", "PtrStruct1.S1Int")
+
+	var warnings []DeprecatedKeyWarning
+	s.OnDeprecatedKey = func(warning DeprecatedKeyWarning) {
+		warnings = append(warnings, warning)
+	}
+
+	config, err := s.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 28, config.(*StructPtr).PtrStruct1.S1Int)
+
+	expected := []DeprecatedKeyWarning{
+		{Source: "http", Location: server.URL, OldKey: "PtrStruct1.OldInt", NewKey: "PtrStruct1.S1Int"},
+	}
+	assert.Equal(t, expected, warnings)
+}
@@ -37,7 +37,12 @@ func NewKvSource(backend store.Backend, addrs []string, options *store.Config, p
 
 // Parse uses valkeyrie and mapstructure to fill the structure
 func (kv *KvSource) Parse(cmd *flaeg.Command) (*flaeg.Command, error) {
-	err := kv.LoadConfig(cmd.Config)
+	return kv.parseRewritten(cmd, nil)
+}
+
+// parseRewritten parses the KV Store like Parse, rewriting the raw key tree with rewrite before decoding it
+func (kv *KvSource) parseRewritten(cmd *flaeg.Command, rewrite treeRewriter) (*flaeg.Command, error) {
+	_, err := kv.loadConfigRevision(cmd.Config, rewrite)
 	if err != nil {
 		return nil, err
 	}
@@ -46,16 +51,71 @@ func (kv *KvSource) Parse(cmd *flaeg.Command) (*flaeg.Command, error) {
 
 // LoadConfig loads data from the KV Store into the config structure (given by reference)
 func (kv *KvSource) LoadConfig(config interface{}) error {
-	pairs, err := kv.ListValuedPairWithPrefix(kv.Prefix)
+	_, err := kv.LoadConfigRevision(config)
+	return err
+}
+
+// LoadConfigRevision loads data from the KV Store into the config structure (given by reference)
+// It returns the revision of the loaded data, to give to StoreConfigIfUnchanged
+func (kv *KvSource) LoadConfigRevision(config interface{}) (Revision, error) {
+	return kv.loadConfigRevision(config, nil)
+}
+
+func (kv *KvSource) loadConfigRevision(config interface{}, rewrite treeRewriter) (Revision, error) {
+	pairs, err := kv.listPairsWithPrefix(kv.Prefix)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	valued := valuedPairs(pairs)
+	for key := range valued {
+		if kv.isReservedKey(key) {
+			delete(valued, key)
+		}
+	}
+
+	mapStruct, err := generateMapstructure(convertPairs(valued), kv.Prefix)
 	if err != nil {
+		return Revision{}, err
+	}
+	if rewrite != nil {
+		prefix := strings.Trim(kv.Prefix, "/")
+		_, err := rewrite(&rawTree{
+			tree:   mapStruct,
+			source: "kv",
+			location: func(key []string) string {
+				return prefix + "/" + strings.Join(key, "/")
+			},
+		})
+		if err != nil {
+			return Revision{}, err
+		}
+	}
+	if err := decodeMapstructure(mapStruct, config); err != nil {
+		return Revision{}, err
+	}
+	return newRevision(pairs, kv.Prefix), nil
+}
+
+// ExportToml loads data from the KV Store into the config structure (given by reference)
+// and writes it as a TOML document which can be loaded by TomlSource
+func (kv *KvSource) ExportToml(config interface{}, w io.Writer) error {
+	if err := kv.LoadConfig(config); err != nil {
 		return err
 	}
+	return EncodeToml(config, w)
+}
 
-	mapStruct, err := generateMapstructure(convertPairs(pairs), kv.Prefix)
+func decodePairs(pairs map[string][]byte, prefix string, config interface{}) error {
+	mapStruct, err := generateMapstructure(convertPairs(pairs), prefix)
 	if err != nil {
 		return err
 	}
+	return decodeMapstructure(mapStruct, config)
+}
 
+// decodeMapstructure decodes the raw key tree of a KV Store into the config structure (given by reference)
+func decodeMapstructure(mapStruct map[string]interface{}, config interface{}) error {
 	configDecoder := &mapstructure.DecoderConfig{
 		Metadata:         nil,
 		Result:           config,
@@ -197,20 +257,301 @@ func (kv *KvSource) StoreConfig(config interface{}) error {
 	}
 	sort.Strings(keys)
 	for _, k := range keys {
-		var writeOptions *store.WriteOptions
-		// is it a directory ?
-		if strings.HasSuffix(k, "/") {
-			writeOptions = &store.WriteOptions{
-				IsDir: true,
+		if err := kv.Put(k, []byte(kvMap[k]), writeOptions(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockSuffix is appended to Prefix to get the key locked by StoreConfigAtomic and StoreConfigIfUnchanged
+// The lock key is a sibling of the configuration tree, so that it's never loaded as a configuration key
+const LockSuffix = ".lock"
+
+func lockKey(prefix string) string {
+	return strings.Trim(prefix, "/") + LockSuffix
+}
+
+func writeOptions(key string) *store.WriteOptions {
+	// is it a directory ?
+	if strings.HasSuffix(key, "/") {
+		return &store.WriteOptions{
+			IsDir: true,
+		}
+	}
+	return nil
+}
+
+// PartialWriteError is returned by StoreConfigAtomic when it fails after having written some keys
+type PartialWriteError struct {
+	Key         string   // the key which couldn't be written
+	Err         error    // the cause of the failure
+	Written     []string // the keys written before the failure
+	RollbackErr error    // not nil if the written keys couldn't be restored
+}
+
+func (e *PartialWriteError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("failed to store key %s: %v (rollback of %d keys failed: %v)", e.Key, e.Err, len(e.Written), e.RollbackErr)
+	}
+	return fmt.Sprintf("failed to store key %s: %v (%d keys rolled back)", e.Key, e.Err, len(e.Written))
+}
+
+// StoreConfigAtomic stores the config into the KV Store holding the lock of Prefix (see LockSuffix)
+// Each key is written using AtomicPut with the previous KVPair, so that a key modified by another writer isn't overwritten.
+// If a write fails, the keys already written are restored and a *PartialWriteError is returned
+func (kv *KvSource) StoreConfigAtomic(config interface{}) error {
+	kvMap := map[string]string{}
+	if err := collateKvRecursive(reflect.ValueOf(config), kvMap, kv.Prefix); err != nil {
+		return err
+	}
+
+	locker, err := kv.NewLock(lockKey(kv.Prefix), nil)
+	if err != nil {
+		return err
+	}
+	lost, err := locker.Lock(nil)
+	if err != nil {
+		return err
+	}
+	defer locker.Unlock()
+
+	return kv.storeKvMapAtomic(kvMap, lost)
+}
+
+func (kv *KvSource) storeKvMapAtomic(kvMap map[string]string, lost <-chan struct{}) error {
+	var keys []string
+	for key := range kvMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// previous pairs of the written keys, nil if the key has been created
+	var written []string
+	previousPairs := map[string]*store.KVPair{}
+	for _, k := range keys {
+		err := kv.atomicPut(k, kvMap[k], previousPairs, lost)
+		if err != nil {
+			return &PartialWriteError{
+				Key:         k,
+				Err:         err,
+				Written:     written,
+				RollbackErr: kv.rollback(written, previousPairs),
 			}
 		}
-		if err := kv.Put(k, []byte(kvMap[k]), writeOptions); err != nil {
+		written = append(written, k)
+	}
+	return nil
+}
+
+func (kv *KvSource) atomicPut(key string, value string, previousPairs map[string]*store.KVPair, lost <-chan struct{}) error {
+	select {
+	case <-lost:
+		return store.ErrCannotLock
+	default:
+	}
+
+	previous, err := kv.Get(key, nil)
+	if err != nil && err != store.ErrKeyNotFound {
+		return err
+	}
+	if err == store.ErrKeyNotFound {
+		previous = nil
+	}
+
+	// AtomicPut doesn't keep IsDir, directories are created with Put if they don't exist yet
+	if strings.HasSuffix(key, "/") {
+		if previous != nil {
+			return nil
+		}
+		if err := kv.Put(key, nil, writeOptions(key)); err != nil {
+			return err
+		}
+		previousPairs[key] = nil
+		return nil
+	}
+
+	ok, _, err := kv.AtomicPut(key, []byte(value), previous, writeOptions(key))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrKeyModified
+	}
+	previousPairs[key] = previous
+	return nil
+}
+
+// rollback restores the previous values of the written keys, in reverse order
+func (kv *KvSource) rollback(written []string, previousPairs map[string]*store.KVPair) error {
+	for i := len(written) - 1; i >= 0; i-- {
+		k := written[i]
+		var err error
+		if previous := previousPairs[k]; previous == nil {
+			err = kv.Delete(k)
+		} else {
+			err = kv.Put(k, previous.Value, writeOptions(k))
+		}
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// ErrConfigModified is returned by StoreConfigIfUnchanged when the configuration has been modified in the KV Store
+// since the given revision
+var ErrConfigModified = errors.New("configuration modified in the KV Store since it was loaded")
+
+// Revision identifies the state of the keys under a prefix in the KV Store
+type Revision struct {
+	LastIndex uint64 // highest LastIndex of the keys
+	Keys      int    // number of keys, to detect deletions
+}
+
+func newRevision(pairs []*store.KVPair, prefix string) Revision {
+	var revision Revision
+	for _, p := range pairs {
+		key, ok := keyUnderPrefix(p.Key, prefix)
+		if !ok || key == lockKey(prefix) {
+			continue
+		}
+		revision.Keys++
+		if p.LastIndex > revision.LastIndex {
+			revision.LastIndex = p.LastIndex
+		}
+	}
+	return revision
+}
+
+// StoreConfigIfUnchanged stores the config into the KV Store like StoreConfigAtomic, if nothing under Prefix has changed
+// since revision (returned by LoadConfigRevision). Otherwise it returns ErrConfigModified.
+// It returns the new revision of the stored data
+func (kv *KvSource) StoreConfigIfUnchanged(config interface{}, revision Revision) (Revision, error) {
+	kvMap := map[string]string{}
+	if err := collateKvRecursive(reflect.ValueOf(config), kvMap, kv.Prefix); err != nil {
+		return revision, err
+	}
+
+	locker, err := kv.NewLock(lockKey(kv.Prefix), nil)
+	if err != nil {
+		return revision, err
+	}
+	lost, err := locker.Lock(nil)
+	if err != nil {
+		return revision, err
+	}
+	defer locker.Unlock()
+
+	pairs, err := kv.listPairsWithPrefix(kv.Prefix)
+	if err != nil {
+		return revision, err
+	}
+	if newRevision(pairs, kv.Prefix) != revision {
+		return revision, ErrConfigModified
+	}
+
+	if err := kv.storeKvMapAtomic(kvMap, lost); err != nil {
+		return revision, err
+	}
+
+	pairs, err = kv.listPairsWithPrefix(kv.Prefix)
+	if err != nil {
+		return revision, err
+	}
+	return newRevision(pairs, kv.Prefix), nil
+}
+
+// SyncConfig stores the config into the KV Store and deletes the keys under Prefix which don't belong to it anymore
+// (removed map entries, shrunk slices...). Only the added or modified keys are written.
+// If dryRun is true, the KV Store is left untouched.
+// It returns the changes made (or planned) sorted by key
+func (kv *KvSource) SyncConfig(config interface{}, dryRun bool) ([]KeyChange, error) {
+	kvMap, err := collateKvUnderPrefix(config, kv.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return kv.syncKvMap(kvMap, dryRun)
+}
+
+func (kv *KvSource) syncKvMap(kvMap map[string]string, dryRun bool) ([]KeyChange, error) {
+	current, err := kv.listKeysWithPrefix(kv.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	for key := range current {
+		if kv.isReservedKey(key) {
+			delete(current, key)
+		}
+	}
+
+	changes := diffKv(current, kvMap)
+	if dryRun {
+		return changes, nil
+	}
+
+	// Children are removed before their parent directory
+	for i := len(changes) - 1; i >= 0; i-- {
+		if changes[i].Type == KeyRemoved {
+			if err := kv.Delete(changes[i].Key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, c := range changes {
+		if c.Type == KeyRemoved {
+			continue
+		}
+		if err := kv.Put(c.Key, []byte(c.NewValue), writeOptions(c.Key)); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// listKeysWithPrefix lists all keys under prefix, including the empty ones (directories)
+func (kv *KvSource) listKeysWithPrefix(prefix string) (map[string]string, error) {
+	keys := make(map[string]string)
+
+	pairs, err := kv.listPairsWithPrefix(prefix)
+	if err != nil {
+		return keys, err
+	}
+
+	for _, p := range pairs {
+		if key, ok := keyUnderPrefix(p.Key, prefix); ok {
+			keys[key] = string(p.Value)
+		}
+	}
+	return keys, nil
+}
+
+// keyUnderPrefix returns the key without leading "/" (as some backends return them), and true if it is a child of prefix
+// Every key is a child of the empty prefix
+func keyUnderPrefix(key string, prefix string) (string, bool) {
+	key = strings.TrimPrefix(key, "/")
+	root := strings.Trim(prefix, "/")
+	if len(root) == 0 {
+		return key, len(key) > 0
+	}
+	root += "/"
+	return key, key != root && strings.HasPrefix(key, root)
+}
+
+// collateKvUnderPrefix collates the config under prefix, with the keys without leading "/" like the ones
+// of listKeysWithPrefix, so that they can be compared whether prefix starts with "/" or not
+func collateKvUnderPrefix(config interface{}, prefix string) (map[string]string, error) {
+	kvMap := map[string]string{}
+	if err := collateKvRecursive(reflect.ValueOf(config), kvMap, prefix); err != nil {
+		return nil, err
+	}
+	normalized := make(map[string]string, len(kvMap))
+	for key, value := range kvMap {
+		normalized[strings.TrimPrefix(key, "/")] = value
+	}
+	return normalized, nil
+}
+
 func collateKvRecursive(objValue reflect.Value, kv map[string]string, key string) error {
 	name := key
 	kind := objValue.Kind()
@@ -362,23 +703,30 @@ func (kv *KvSource) ListRecursive(key string, pairs map[string][]byte) error {
 
 // ListValuedPairWithPrefix lists all key value children under key
 func (kv *KvSource) ListValuedPairWithPrefix(key string) (map[string][]byte, error) {
-	pairs := make(map[string][]byte)
+	pairsN1, err := kv.listPairsWithPrefix(key)
+	if err != nil {
+		return make(map[string][]byte), err
+	}
 
-	pairsN1, err := kv.List(key, nil)
+	return valuedPairs(pairsN1), nil
+}
+
+func (kv *KvSource) listPairsWithPrefix(key string) ([]*store.KVPair, error) {
+	pairs, err := kv.List(key, nil)
 	if err == store.ErrKeyNotFound {
-		return pairs, nil
-	}
-	if err != nil {
-		return pairs, err
+		return nil, nil
 	}
+	return pairs, err
+}
 
+func valuedPairs(pairsN1 []*store.KVPair) map[string][]byte {
+	pairs := make(map[string][]byte)
 	for _, p := range pairsN1 {
 		if len(p.Value) > 0 {
 			pairs[p.Key] = p.Value
 		}
 	}
-
-	return pairs, nil
+	return pairs
 }
 
 func convertPairs(pairs map[string][]byte) []*store.KVPair {
@@ -14,10 +14,28 @@ type Mock struct {
 	WatchTreeMethod func() <-chan []*store.KVPair
 	ListError       error
 	GetError        error
+	// AtomicPutErrorKey makes AtomicPut fail on this key
+	AtomicPutErrorKey string
+	Locked            bool
+	// LockKey is the key of the last lock created
+	LockKey string
+	// DirKeys are the keys written with IsDir
+	DirKeys []string
+	index   uint64
 }
 
 func (s *Mock) Put(key string, value []byte, opts *store.WriteOptions) error {
-	s.KVPairs = append(s.KVPairs, &store.KVPair{Key: key, Value: value, LastIndex: 0})
+	if opts != nil && opts.IsDir {
+		s.DirKeys = append(s.DirKeys, key)
+	}
+	for _, kvPair := range s.KVPairs {
+		if kvPair.Key == key {
+			kvPair.Value = value
+			kvPair.LastIndex = s.nextIndex()
+			return nil
+		}
+	}
+	s.KVPairs = append(s.KVPairs, &store.KVPair{Key: key, Value: value, LastIndex: s.nextIndex()})
 
 	return nil
 }
@@ -33,14 +51,21 @@ func (s *Mock) Get(key string, options *store.ReadOptions) (*store.KVPair, error
 
 	for _, kvPair := range s.KVPairs {
 		if kvPair.Key == key {
-			return kvPair, nil
+			pair := *kvPair
+			return &pair, nil
 		}
 	}
 	return nil, nil
 }
 
 func (s *Mock) Delete(key string) error {
-	return errors.New("delete not supported")
+	for i, kvPair := range s.KVPairs {
+		if kvPair.Key == key {
+			s.KVPairs = append(s.KVPairs[:i], s.KVPairs[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrKeyNotFound
 }
 
 // Exists mock
@@ -58,9 +83,32 @@ func (s *Mock) WatchTree(prefix string, stopCh <-chan struct{}, options *store.R
 	return s.WatchTreeMethod(), nil
 }
 
+func (s *Mock) nextIndex() uint64 {
+	s.index++
+	return s.index
+}
+
 // NewLock mock
 func (s *Mock) NewLock(key string, options *store.LockOptions) (store.Locker, error) {
-	return nil, errors.New("NewLock not supported")
+	s.LockKey = key
+	return &mockLocker{mock: s}, nil
+}
+
+type mockLocker struct {
+	mock *Mock
+}
+
+func (l *mockLocker) Lock(stopChan chan struct{}) (<-chan struct{}, error) {
+	if l.mock.Locked {
+		return nil, store.ErrCannotLock
+	}
+	l.mock.Locked = true
+	return make(chan struct{}), nil
+}
+
+func (l *mockLocker) Unlock() error {
+	l.mock.Locked = false
+	return nil
 }
 
 // List mock
@@ -89,7 +137,30 @@ func (s *Mock) DeleteTree(prefix string) error {
 
 // AtomicPut mock
 func (s *Mock) AtomicPut(key string, value []byte, previous *store.KVPair, opts *store.WriteOptions) (bool, *store.KVPair, error) {
-	return false, nil, errors.New("AtomicPut not supported")
+	if key == s.AtomicPutErrorKey {
+		return false, nil, errors.New("AtomicPut error")
+	}
+
+	for _, kvPair := range s.KVPairs {
+		if kvPair.Key == key {
+			if previous == nil {
+				return false, nil, store.ErrKeyExists
+			}
+			if previous.LastIndex != kvPair.LastIndex {
+				return false, nil, store.ErrKeyModified
+			}
+			kvPair.Value = value
+			kvPair.LastIndex = s.nextIndex()
+			return true, kvPair, nil
+		}
+	}
+	if previous != nil {
+		return false, nil, store.ErrKeyNotFound
+	}
+
+	kvPair := &store.KVPair{Key: key, Value: value, LastIndex: s.nextIndex()}
+	s.KVPairs = append(s.KVPairs, kvPair)
+	return true, kvPair, nil
 }
 
 // AtomicDelete mock
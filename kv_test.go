@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -807,6 +810,373 @@ func TestStoreConfigEmbeddedSquash(t *testing.T) {
 	}
 }
 
+func TestSyncConfigRemovesOrphanKeys(t *testing.T) {
+	config := &struct {
+		Vfoo   string
+		Vmap   map[string]string
+		Vslice []int
+	}{
+		Vfoo:   "toto",
+		Vmap:   map[string]string{"k1": "v1"},
+		Vslice: []int{51},
+	}
+	kv := &KvSource{
+		&Mock{
+			KVPairs: []*store.KVPair{
+				{Key: "prefix/vfoo", Value: []byte("tata")},
+				{Key: "prefix/vmap/k1", Value: []byte("v1")},
+				{Key: "prefix/vmap/k2", Value: []byte("v2")},
+				{Key: "prefix/vslice/0", Value: []byte("51")},
+				{Key: "prefix/vslice/1", Value: []byte("15")},
+				{Key: "otherprefix/vfoo", Value: []byte("other")},
+			},
+		},
+		"prefix",
+	}
+
+	changes, err := kv.SyncConfig(config, false)
+	require.NoError(t, err)
+
+	expectedChanges := []KeyChange{
+		{Key: "prefix/vfoo", Type: KeyModified, OldValue: "tata", NewValue: "toto"},
+		{Key: "prefix/vmap/k2", Type: KeyRemoved, OldValue: "v2"},
+		{Key: "prefix/vslice/1", Type: KeyRemoved, OldValue: "15"},
+	}
+	assert.Equal(t, expectedChanges, changes)
+
+	result, err := kv.ListValuedPairWithPrefix("prefix")
+	require.NoError(t, err)
+
+	expected := map[string][]byte{
+		"prefix/vfoo":     []byte("toto"),
+		"prefix/vmap/k1":  []byte("v1"),
+		"prefix/vslice/0": []byte("51"),
+	}
+	assert.Equal(t, expected, result)
+
+	other, err := kv.Get("otherprefix/vfoo", nil)
+	require.NoError(t, err)
+	require.NotNil(t, other)
+}
+
+func TestSyncConfigDryRun(t *testing.T) {
+	config := &struct {
+		Vfoo string
+		Vbar string
+	}{
+		Vfoo: "toto",
+		Vbar: "titi",
+	}
+	mock := &Mock{
+		KVPairs: []*store.KVPair{
+			{Key: "prefix/vfoo", Value: []byte("toto")},
+			{Key: "prefix/vold", Value: []byte("tata")},
+		},
+	}
+	kv := &KvSource{mock, "prefix"}
+
+	changes, err := kv.SyncConfig(config, true)
+	require.NoError(t, err)
+
+	expectedChanges := []KeyChange{
+		{Key: "prefix/vbar", Type: KeyAdded, NewValue: "titi"},
+		{Key: "prefix/vold", Type: KeyRemoved, OldValue: "tata"},
+	}
+	assert.Equal(t, expectedChanges, changes)
+
+	expected := []*store.KVPair{
+		{Key: "prefix/vfoo", Value: []byte("toto")},
+		{Key: "prefix/vold", Value: []byte("tata")},
+	}
+	assert.Equal(t, expected, mock.KVPairs)
+}
+
+func TestSyncConfigLeadingSlashPrefix(t *testing.T) {
+	config := &struct {
+		Vfoo string
+		Vbar string
+	}{
+		Vfoo: "toto",
+		Vbar: "titi",
+	}
+	mock := &Mock{
+		KVPairs: []*store.KVPair{
+			{Key: "/prefix/vfoo", Value: []byte("toto")},
+			{Key: "/prefix/vold", Value: []byte("tata")},
+		},
+	}
+	kv := &KvSource{mock, "/prefix"}
+
+	changes, err := kv.SyncConfig(config, true)
+	require.NoError(t, err)
+
+	expectedChanges := []KeyChange{
+		{Key: "prefix/vbar", Type: KeyAdded, NewValue: "titi"},
+		{Key: "prefix/vold", Type: KeyRemoved, OldValue: "tata"},
+	}
+	assert.Equal(t, expectedChanges, changes)
+}
+
+func TestStoreConfigAtomic(t *testing.T) {
+	config := &struct {
+		Vfoo string
+		Vbar string
+	}{
+		Vfoo: "toto",
+		Vbar: "titi",
+	}
+	mock := &Mock{
+		KVPairs: []*store.KVPair{
+			{Key: "prefix/vfoo", Value: []byte("tata")},
+		},
+	}
+	kv := &KvSource{mock, "prefix"}
+
+	err := kv.StoreConfigAtomic(config)
+	require.NoError(t, err)
+
+	result, err := kv.ListValuedPairWithPrefix("prefix")
+	require.NoError(t, err)
+
+	expected := map[string][]byte{
+		"prefix/vbar": []byte("titi"),
+		"prefix/vfoo": []byte("toto"),
+	}
+	assert.Equal(t, expected, result)
+	assert.False(t, mock.Locked)
+	assert.Equal(t, "prefix.lock", mock.LockKey)
+}
+
+func TestStoreConfigAtomicDirectories(t *testing.T) {
+	type subConfig struct {
+		Vfoo string
+	}
+	config := &struct {
+		Vbar       string
+		PtrStruct1 *subConfig
+		PtrStruct2 *subConfig
+	}{
+		Vbar:       "tata",
+		PtrStruct1: &subConfig{Vfoo: "toto"},
+		PtrStruct2: &subConfig{Vfoo: "titi"},
+	}
+	mock := &Mock{
+		KVPairs: []*store.KVPair{
+			{Key: "prefix/ptrstruct2/", LastIndex: 1},
+		},
+	}
+	kv := &KvSource{mock, "prefix"}
+
+	err := kv.StoreConfigAtomic(config)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"prefix/ptrstruct1/"}, mock.DirKeys)
+
+	pair, err := kv.Get("prefix/ptrstruct2/", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), pair.LastIndex)
+
+	pair, err = kv.Get("prefix/ptrstruct2/vfoo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "titi", string(pair.Value))
+}
+
+func TestStoreConfigAtomicEmptyPrefix(t *testing.T) {
+	mock := &Mock{
+		KVPairs: []*store.KVPair{
+			{Key: ".lock", Value: []byte("session"), LastIndex: 1},
+		},
+	}
+	kv := &KvSource{mock, ""}
+
+	err := kv.StoreConfigAtomic(&struct{ Vfoo string }{Vfoo: "toto"})
+	require.NoError(t, err)
+	assert.Equal(t, ".lock", mock.LockKey)
+
+	revision, err := kv.LoadConfigRevision(&struct{ Vfoo string }{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, revision.Keys)
+
+	changes, err := kv.SyncConfig(&struct{ Vfoo string }{Vfoo: "toto"}, true)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestStoreConfigAtomicRollback(t *testing.T) {
+	config := &struct {
+		Va string
+		Vb string
+		Vc string
+	}{
+		Va: "new",
+		Vb: "new",
+		Vc: "new",
+	}
+	mock := &Mock{
+		KVPairs: []*store.KVPair{
+			{Key: "prefix/vb", Value: []byte("old")},
+		},
+		AtomicPutErrorKey: "prefix/vc",
+	}
+	kv := &KvSource{mock, "prefix"}
+
+	err := kv.StoreConfigAtomic(config)
+	require.Error(t, err)
+
+	partialErr, ok := err.(*PartialWriteError)
+	require.True(t, ok)
+	assert.Equal(t, "prefix/vc", partialErr.Key)
+	assert.Equal(t, []string{"prefix/va", "prefix/vb"}, partialErr.Written)
+	assert.NoError(t, partialErr.RollbackErr)
+
+	result, err := kv.ListValuedPairWithPrefix("prefix")
+	require.NoError(t, err)
+
+	expected := map[string][]byte{
+		"prefix/vb": []byte("old"),
+	}
+	assert.Equal(t, expected, result)
+	assert.False(t, mock.Locked)
+}
+
+func TestStoreConfigAtomicLocked(t *testing.T) {
+	mock := &Mock{Locked: true}
+	kv := &KvSource{mock, "prefix"}
+
+	err := kv.StoreConfigAtomic(&struct{ Vfoo string }{Vfoo: "toto"})
+	assert.Equal(t, store.ErrCannotLock, err)
+	assert.Empty(t, mock.KVPairs)
+}
+
+func TestStoreConfigIfUnchanged(t *testing.T) {
+	type config struct {
+		Vfoo string
+	}
+	mock := &Mock{}
+	kv := &KvSource{mock, "prefix"}
+
+	require.NoError(t, kv.Put("prefix/vfoo", []byte("toto"), nil))
+
+	loaded := &config{}
+	revision, err := kv.LoadConfigRevision(loaded)
+	require.NoError(t, err)
+	assert.Equal(t, Revision{LastIndex: 1, Keys: 1}, revision)
+
+	// another operator stores its configuration first
+	_, err = kv.StoreConfigIfUnchanged(&config{Vfoo: "tata"}, revision)
+	require.NoError(t, err)
+
+	loaded.Vfoo = "titi"
+	_, err = kv.StoreConfigIfUnchanged(loaded, revision)
+	assert.Equal(t, ErrConfigModified, err)
+	assert.False(t, mock.Locked)
+	assert.Equal(t, "prefix.lock", mock.LockKey)
+
+	pair, err := kv.Get("prefix/vfoo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "tata", string(pair.Value))
+
+	revision, err = kv.LoadConfigRevision(loaded)
+	require.NoError(t, err)
+
+	loaded.Vfoo = "titi"
+	newRevision, err := kv.StoreConfigIfUnchanged(loaded, revision)
+	require.NoError(t, err)
+	assert.NotEqual(t, revision, newRevision)
+
+	pair, err = kv.Get("prefix/vfoo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "titi", string(pair.Value))
+}
+
+func TestStoreConfigIfUnchangedKeyDeleted(t *testing.T) {
+	mock := &Mock{
+		KVPairs: []*store.KVPair{
+			{Key: "prefix/vfoo", Value: []byte("toto"), LastIndex: 1},
+			{Key: "prefix/vbar", Value: []byte("tata"), LastIndex: 2},
+		},
+	}
+	kv := &KvSource{mock, "prefix"}
+
+	config := &struct {
+		Vfoo string
+		Vbar string
+	}{}
+	revision, err := kv.LoadConfigRevision(config)
+	require.NoError(t, err)
+
+	require.NoError(t, kv.Delete("prefix/vfoo"))
+
+	_, err = kv.StoreConfigIfUnchanged(config, revision)
+	assert.Equal(t, ErrConfigModified, err)
+}
+
+func TestExportToml(t *testing.T) {
+	kv := &KvSource{
+		&Mock{
+			KVPairs: []*store.KVPair{
+				{Key: "prefix/ptrstruct1/s1int", Value: []byte("1")},
+				{Key: "prefix/ptrstruct1/s1string", Value: []byte("S1StringInitConfig")},
+				{Key: "prefix/ptrstruct1/s1ptrstruct3/", Value: []byte("")},
+				{Key: "prefix/ptrstruct1/s1ptrstruct3/s3float64", Value: []byte("1.5")},
+				{Key: "prefix/durationfield", Value: []byte("21000000000")},
+			},
+		},
+		"prefix",
+	}
+
+	buffer := &bytes.Buffer{}
+	err := kv.ExportToml(&StructPtr{}, buffer)
+	require.NoError(t, err)
+
+	expected := `DurationField = "21s"
+
+[PtrStruct1]
+  S1Bool = false
+  S1Int = 1
+  S1String = "S1StringInitConfig"
+  [PtrStruct1.S1PtrStruct3]
+    S3Float64 = 1.5
+`
+	assert.Equal(t, expected, buffer.String())
+}
+
+func TestExportTomlRoundTrip(t *testing.T) {
+	type bytesConfig struct {
+		Name string
+		Data []byte
+	}
+	config := &bytesConfig{Name: "toto", Data: []byte{0, 1, 255}}
+
+	kv := &KvSource{&Mock{}, "prefix"}
+	require.NoError(t, kv.StoreConfig(config))
+
+	dir, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file, err := os.Create(filepath.Join(dir, "export.toml"))
+	require.NoError(t, err)
+	err = kv.ExportToml(&bytesConfig{}, file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                &bytesConfig{},
+		DefaultPointersConfig: &bytesConfig{},
+		Run: func() error {
+			return nil
+		},
+	}
+
+	_, err = NewTomlSource("export", []string{dir}).Parse(cmd)
+	require.NoError(t, err)
+
+	assert.Equal(t, config, cmd.Config)
+}
+
 func TestCollateKvPairsUnexported(t *testing.T) {
 	config := &struct {
 		Vstring string
@@ -0,0 +1,451 @@
+package staert
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/containous/flaeg"
+)
+
+// LintIssue is a problem found in a configuration by the linter
+type LintIssue struct {
+	File    string
+	Line    int // 0 if unknown
+	Key     string
+	Message string
+}
+
+func (i LintIssue) String() string {
+	location := i.File
+	if i.Line > 0 {
+		location += ":" + strconv.Itoa(i.Line)
+	}
+	if len(i.Key) > 0 {
+		return fmt.Sprintf("%s: %s: %s", location, i.Key, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", location, i.Message)
+}
+
+// Validator is implemented by the configurations which check their values after being loaded
+type Validator interface {
+	Validate() error
+}
+
+// LintToml checks the TOML file path against the command configuration without running the command
+// It reports syntax errors, unknown keys, type errors, deprecated keys (fields with a "deprecated" tag)
+// and, if the configuration loaded over a copy of the command Config implements Validator, validation failures
+func LintToml(cmd *flaeg.Command, path string) ([]LintIssue, error) {
+	return lintToml(cmd, nil, path)
+}
+
+// LintToml checks the TOML file path against the root command configuration like the LintToml function,
+// applying the upgrades and the key aliases of s: the old keys are reported as deprecated keys,
+// an old configuration version as upgraded, and the version key (see VersionKey) is known
+func (s *Staert) LintToml(path string) ([]LintIssue, error) {
+	return lintToml(s.command, s, path)
+}
+
+// lintToml lints the TOML file path, applying the upgrades and the key aliases of s if not nil
+func lintToml(cmd *flaeg.Command, s *Staert, path string) ([]LintIssue, error) {
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []LintIssue
+	data := original
+	var raw *rawTree
+	var rewrite treeRewriter
+	versionKey := ""
+	if s != nil {
+		var ok bool
+		data, raw, rewrite, ok = lintRewriteToml(s, path, original, &issues)
+		if !ok {
+			return issues, nil
+		}
+		versionKey = s.VersionKey
+	}
+
+	tree := make(map[string]interface{})
+	metadata, err := toml.Decode(string(data), &tree)
+	if err != nil {
+		return []LintIssue{{File: path, Line: newTomlError(path, data, cmd.Config, err).Line, Message: err.Error()}}, nil
+	}
+
+	configType := reflect.TypeOf(cmd.Config).Elem()
+	lines := tomlKeyLines(original)
+	failed := false
+	for _, key := range metadata.Keys() {
+		name := key.String()
+		if raw != nil {
+			name = raw.origin(name)
+		}
+		messages, keyFailed := lintTomlKey(configType, versionKey, key, metadata, tree)
+		for _, message := range messages {
+			issues = append(issues, LintIssue{File: path, Line: lines[name], Key: key.String(), Message: message})
+		}
+		failed = failed || keyFailed
+	}
+	if failed {
+		return issues, nil
+	}
+	return append(issues, lintTomlConfig(cmd, path, rewrite)...), nil
+}
+
+// lintRewriteToml applies the upgrades and the key aliases of s to data, reporting them as issues
+// It returns the rewriter for TomlSource, which doesn't report them again, and false if the rewrite failed
+func lintRewriteToml(s *Staert, path string, data []byte, issues *[]LintIssue) ([]byte, *rawTree, treeRewriter, bool) {
+	quiet := *s
+	quiet.OnDeprecatedKey = func(warning DeprecatedKeyWarning) {
+		*issues = append(*issues, LintIssue{File: path, Line: locationLine(path, warning.Location), Key: warning.OldKey, Message: "deprecated key: use " + warning.NewKey + " instead"})
+	}
+	quiet.OnUpgrade = func(notice UpgradeNotice) {
+		*issues = append(*issues, LintIssue{File: path, Line: locationLine(path, notice.Location), Key: s.VersionKey, Message: fmt.Sprintf("configuration version %d is upgraded to %d", notice.From, notice.To)})
+	}
+	rewritten, raw, err := rewriteToml(path, data, quiet.rewriteTree)
+	if err != nil {
+		issue := LintIssue{File: path, Message: err.Error()}
+		// the upgrade errors start with the location of the version key
+		if parts := strings.SplitN(issue.Message, ": ", 2); len(parts) == 2 && strings.HasPrefix(parts[0], path) {
+			issue.Line, issue.Message = locationLine(path, parts[0]), parts[1]
+		}
+		*issues = append(*issues, issue)
+		return nil, nil, nil, false
+	}
+
+	// the issues of the rewritten keys are already reported
+	quiet.OnDeprecatedKey = func(DeprecatedKeyWarning) {}
+	quiet.OnUpgrade = func(UpgradeNotice) {}
+	return rewritten, raw, quiet.rewriteTree, true
+}
+
+// lintTomlKey checks the TOML key against the config type, it returns the issues and true if the key can't be loaded
+func lintTomlKey(configType reflect.Type, versionKey string, key toml.Key, metadata toml.MetaData, tree map[string]interface{}) ([]string, bool) {
+	_, deprecated, known := resolveConfigKey(configType, key, true)
+	var messages []string
+	switch {
+	case !known && len(versionKey) > 0 && strings.EqualFold(key.String(), versionKey):
+		// the version key is used by the upgrades, the config doesn't need to hold it
+		return nil, false
+	case !known:
+		return []string{"unknown key"}, true
+	case deprecated != nil:
+		messages = append(messages, "deprecated key: "+deprecated.Tag.Get("deprecated"))
+	}
+
+	if metadata.Type(key...) == "Hash" || metadata.Type(key...) == "ArrayHash" {
+		return messages, false
+	}
+	value, ok := tomlTreeValue(tree, key)
+	if !ok {
+		return messages, false
+	}
+	if err := decodeTomlValue(configType, key, value); err != nil {
+		return append(messages, err.Error()), true
+	}
+	return messages, false
+}
+
+// lintTomlConfig loads the TOML file path into a copy of the command config, and validates it
+func lintTomlConfig(cmd *flaeg.Command, path string, rewrite treeRewriter) []LintIssue {
+	config := deepCopy(cmd.Config)
+	lintCmd := &flaeg.Command{Name: cmd.Name, Config: config, DefaultPointersConfig: deepCopy(cmd.DefaultPointersConfig)}
+	if _, err := NewTomlSource("", []string{path}).parseRewritten(lintCmd, rewrite); err != nil {
+		if tomlErr, ok := err.(*TomlError); ok {
+			return []LintIssue{{File: path, Line: tomlErr.Line, Key: tomlErr.Key, Message: tomlErr.Err.Error()}}
+		}
+		return []LintIssue{{File: path, Message: err.Error()}}
+	}
+	return validateConfig(path, config)
+}
+
+// LintKv checks the KV pairs (key to value, keys under prefix) against the command configuration,
+// like LintToml does for TOML files. The keys of the configuration history and the lock key are ignored
+func LintKv(cmd *flaeg.Command, pairs map[string]string, prefix string) ([]LintIssue, error) {
+	kv := &KvSource{Prefix: prefix}
+	configType := reflect.TypeOf(cmd.Config).Elem()
+
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var issues []LintIssue
+	failed := false
+	valued := make(map[string][]byte)
+	for _, key := range keys {
+		subKey, ok := keyUnderPrefix(key, prefix)
+		if !ok || kv.isReservedKey(key) {
+			continue
+		}
+		if root := strings.Trim(prefix, "/"); len(root) > 0 {
+			subKey = strings.TrimPrefix(subKey, root+"/")
+		}
+		_, deprecated, known := resolveConfigKey(configType, strings.Split(strings.TrimSuffix(subKey, "/"), "/"), false)
+		switch {
+		case !known:
+			issues = append(issues, LintIssue{File: "kv", Key: key, Message: "unknown key"})
+			failed = true
+			continue
+		case deprecated != nil:
+			issues = append(issues, LintIssue{File: "kv", Key: key, Message: "deprecated key: " + deprecated.Tag.Get("deprecated")})
+		}
+
+		if len(pairs[key]) == 0 {
+			continue
+		}
+		valued[key] = []byte(pairs[key])
+		err := decodePairs(map[string][]byte{key: []byte(pairs[key])}, prefix, reflect.New(configType).Interface())
+		if err != nil {
+			issues = append(issues, LintIssue{File: "kv", Key: key, Message: err.Error()})
+			failed = true
+		}
+	}
+	if failed {
+		return issues, nil
+	}
+
+	config := deepCopy(cmd.Config)
+	if err := decodePairs(valued, prefix, config); err != nil {
+		return append(issues, LintIssue{File: "kv", Message: err.Error()}), nil
+	}
+	return append(issues, validateConfig("kv", config)...), nil
+}
+
+// locationLine returns the line of the location of a key in file, like "example.toml:12", 0 if none
+func locationLine(file string, location string) int {
+	line, _ := strconv.Atoi(strings.TrimPrefix(location, file+":"))
+	return line
+}
+
+// ReadKvSnapshot reads a KV Store snapshot: a JSON object of keys to values
+func ReadKvSnapshot(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make(map[string]string)
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, fmt.Errorf("invalid KV snapshot %s: %v", path, err)
+	}
+	return pairs, nil
+}
+
+// LintConfig is the configuration of the lint command
+type LintConfig struct {
+	File       string `description:"TOML file to lint"`
+	KvSnapshot string `description:"JSON file of a KV Store snapshot (key to value) to lint"`
+	KvPrefix   string `description:"Prefix of the KV Store snapshot keys"`
+}
+
+// NewLintCommand creates the "lint" command, which lints the configuration files of the command cmd without running it
+// The issues are written on w, the command fails if any is found
+func NewLintCommand(cmd *flaeg.Command, w io.Writer) *flaeg.Command {
+	return newLintCommand(cmd, nil, w)
+}
+
+// NewLintCommand creates the "lint" command like the NewLintCommand function, for the root command,
+// the TOML files being linted with s.LintToml
+func (s *Staert) NewLintCommand(w io.Writer) *flaeg.Command {
+	return newLintCommand(s.command, s, w)
+}
+
+func newLintCommand(cmd *flaeg.Command, s *Staert, w io.Writer) *flaeg.Command {
+	lintConfig := &LintConfig{}
+	return &flaeg.Command{
+		Name:                  "lint",
+		Description:           "Check the configuration files of " + cmd.Name + " without running it",
+		Config:                lintConfig,
+		DefaultPointersConfig: &LintConfig{},
+		Run: func() error {
+			if len(lintConfig.File) == 0 && len(lintConfig.KvSnapshot) == 0 {
+				return errors.New("nothing to lint: --file or --kvsnapshot is required")
+			}
+
+			var issues []LintIssue
+			if len(lintConfig.File) > 0 {
+				tomlIssues, err := lintToml(cmd, s, lintConfig.File)
+				if err != nil {
+					return err
+				}
+				issues = append(issues, tomlIssues...)
+			}
+			if len(lintConfig.KvSnapshot) > 0 {
+				pairs, err := ReadKvSnapshot(lintConfig.KvSnapshot)
+				if err != nil {
+					return err
+				}
+				kvIssues, err := LintKv(cmd, pairs, lintConfig.KvPrefix)
+				if err != nil {
+					return err
+				}
+				issues = append(issues, kvIssues...)
+			}
+
+			for _, issue := range issues {
+				fmt.Fprintln(w, issue)
+			}
+			if len(issues) > 0 {
+				return fmt.Errorf("%d issue(s) found", len(issues))
+			}
+			return nil
+		},
+	}
+}
+
+// resolveConfigKey checks the key parts are a key of typ, like TomlSource (toml) or KvSource do
+// field is the path of the Go field of the key, deprecated is the last deprecated field of the key, if any
+func resolveConfigKey(typ reflect.Type, parts []string, toml bool) (field string, deprecated *reflect.StructField, known bool) {
+	field, known = walkConfigKey(typ, parts, toml, func(structField reflect.StructField) {
+		if _, ok := structField.Tag.Lookup("deprecated"); ok {
+			deprecated = &structField
+		}
+	})
+	return field, deprecated, known
+}
+
+// walkConfigKey calls visit on the struct fields of the key parts in typ, like TomlSource (toml) or KvSource decode them
+// It returns the path of the Go field of the key, and false if the key is unknown
+func walkConfigKey(typ reflect.Type, parts []string, toml bool, visit func(field reflect.StructField)) (string, bool) {
+	field := ""
+	for len(parts) > 0 {
+		if isTextUnmarshaler(typ) {
+			return field, false
+		}
+		switch typ.Kind() {
+		case reflect.Ptr:
+			typ = typ.Elem()
+		case reflect.Struct:
+			structField, ok := findConfigField(typ, parts[0], toml)
+			if !ok {
+				return field, false
+			}
+			visit(structField)
+			field = joinKey(field, ".", structField.Name)
+			typ = structField.Type
+			parts = parts[1:]
+		case reflect.Map:
+			field += "[" + parts[0] + "]"
+			typ = typ.Elem()
+			parts = parts[1:]
+		case reflect.Slice, reflect.Array:
+			typ = typ.Elem()
+			if !toml {
+				// KV keys hold the slice indexes
+				field += "[" + parts[0] + "]"
+				parts = parts[1:]
+			}
+		case reflect.Interface:
+			return field, true
+		default:
+			return field, false
+		}
+	}
+	return field, true
+}
+
+// findConfigField finds the field name of the struct type typ, case insensitively
+// TOML keys use the toml tags and promote the embedded structs fields, KV keys only the squashed ones
+func findConfigField(typ reflect.Type, name string, toml bool) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if isPromotedField(field, toml) {
+			if found, ok := findConfigField(field.Type, name, toml); ok {
+				return found, true
+			}
+			continue
+		}
+		if fieldName, ok := configFieldName(field, toml); ok && strings.EqualFold(fieldName, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// isPromotedField returns true for the embedded structs whose fields are promoted:
+// by TOML if they aren't named, by KvSource if they are squashed
+func isPromotedField(field reflect.StructField, toml bool) bool {
+	if !field.Anonymous || field.Type.Kind() != reflect.Struct {
+		return false
+	}
+	if toml {
+		return strings.Split(field.Tag.Get("toml"), ",")[0] == ""
+	}
+	return strings.Contains(string(field.Tag), "squash")
+}
+
+// configFieldName returns the name of the field in TOML or in the KV Store, false if the field isn't loaded
+func configFieldName(field reflect.StructField, toml bool) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	if !toml {
+		return field.Name, true
+	}
+	switch tomlName := strings.Split(field.Tag.Get("toml"), ",")[0]; tomlName {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	default:
+		return tomlName, true
+	}
+}
+
+func isTextUnmarshaler(typ reflect.Type) bool {
+	textUnmarshalerType := reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	if typ.Kind() != reflect.Ptr {
+		typ = reflect.PtrTo(typ)
+	}
+	return typ.Implements(textUnmarshalerType)
+}
+
+// tomlTreeValue returns the value of the key in the decoded TOML tree, false if it is under an array of tables
+func tomlTreeValue(tree map[string]interface{}, key toml.Key) (interface{}, bool) {
+	var value interface{} = tree
+	for _, part := range key {
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value = table[part]
+	}
+	return value, true
+}
+
+// decodeTomlValue decodes the single TOML value of the key into a new configuration of type configType
+func decodeTomlValue(configType reflect.Type, key toml.Key, value interface{}) error {
+	tree := map[string]interface{}{key[len(key)-1]: value}
+	for i := len(key) - 2; i >= 0; i-- {
+		tree = map[string]interface{}{key[i]: tree}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(tree); err != nil {
+		return err
+	}
+	_, err := toml.Decode(buf.String(), reflect.New(configType).Interface())
+	return err
+}
+
+func validateConfig(file string, config interface{}) []LintIssue {
+	validator, ok := config.(Validator)
+	if !ok {
+		return nil
+	}
+	if err := validator.Validate(); err != nil {
+		return []LintIssue{{File: file, Message: "validation failed: " + err.Error()}}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package staert
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/containous/flaeg"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type LintStruct1 struct {
+	S1Int        int      `description:"Struct 1 Int"`
+	S1String     string   `description:"Struct 1 String"`
+	S1Bool       bool     `description:"Struct 1 Bool"`
+	OldName      string   `description:"Old name" deprecated:"use S1String instead"`
+	S1PtrStruct3 *Struct3 `description:"Enable Struct3"`
+}
+
+type LintConfigType struct {
+	PtrStruct1    *LintStruct1   `description:"Enable Struct1"`
+	DurationField parse.Duration `description:"Duration Field"`
+}
+
+func (c *LintConfigType) Validate() error {
+	if c.PtrStruct1 != nil && c.PtrStruct1.S1Int < 0 {
+		return errors.New("S1Int must be positive")
+	}
+	return nil
+}
+
+func lintCommand() *flaeg.Command {
+	return &flaeg.Command{
+		Name:                  "test",
+		Config:                &LintConfigType{},
+		DefaultPointersConfig: &LintConfigType{PtrStruct1: &LintStruct1{S1Int: 11}},
+		Run:                   func() error { return nil },
+	}
+}
+
+func TestLintToml(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		file     string
+		expected []string
+	}{
+		{
+			desc: "valid",
+			file: "./fixtures/fieldUnderPointer.toml",
+		},
+		{
+			desc: "unknown keys, type errors and deprecated keys",
+			file: "./fixtures/lintErrors.toml",
+			expected: []string{
+				`./fixtures/lintErrors.toml:2: DurationField: time: unknown unit " seconds" in duration "28 seconds"`,
+				"./fixtures/lintErrors.toml:3: Unknown: unknown key",
+				"./fixtures/lintErrors.toml:6: PtrStruct1.S1Int: toml: cannot load TOML value of type string into a Go integer",
+				"./fixtures/lintErrors.toml:8: PtrStruct1.OldName: deprecated key: use S1String instead",
+			},
+		},
+		{
+			desc: "deprecated key and validation failure",
+			file: "./fixtures/lintDeprecated.toml",
+			expected: []string{
+				"./fixtures/lintDeprecated.toml:4: PtrStruct1.OldName: deprecated key: use S1String instead",
+				"./fixtures/lintDeprecated.toml: validation failed: S1Int must be positive",
+			},
+		},
+		{
+			desc: "syntax error",
+			file: "./fixtures/lintSyntax.toml",
+			expected: []string{
+				"./fixtures/lintSyntax.toml:4: Near line 4 (last key parsed 'PtrStruct1.S1String'): strings cannot contain newlines",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			issues, err := LintToml(lintCommand(), test.file)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, issue := range issues {
+				messages = append(messages, issue.String())
+			}
+			assert.Equal(t, test.expected, messages)
+		})
+	}
+}
+
+func TestStaert_LintToml(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		file     string
+		expected []string
+	}{
+		{
+			desc: "aliased keys",
+			file: "./fixtures/alias.toml",
+			expected: []string{
+				"./fixtures/alias.toml:2: Old: deprecated key: use Name instead",
+				"./fixtures/alias.toml:4: OldSection: deprecated key: use NewSection instead",
+				"./fixtures/alias.toml:5: NewSection.OldName: deprecated key: use NewSection.NewName instead",
+			},
+		},
+		{
+			desc: "type error under an aliased key",
+			file: "./fixtures/aliasTypeError.toml",
+			expected: []string{
+				"./fixtures/aliasTypeError.toml:2: Old: deprecated key: use Name instead",
+				"./fixtures/aliasTypeError.toml:4: OldSection: deprecated key: use NewSection instead",
+				"./fixtures/aliasTypeError.toml:5: NewSection.OldName: deprecated key: use NewSection.NewName instead",
+				"./fixtures/aliasTypeError.toml:6: NewSection.Count: toml: cannot load TOML value of type string into a Go integer",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			s, warnings := newAliasStaert(&AliasConfig{})
+
+			issues, err := s.LintToml(test.file)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, issue := range issues {
+				messages = append(messages, issue.String())
+			}
+			assert.Equal(t, test.expected, messages)
+			assert.Empty(t, *warnings)
+		})
+	}
+}
+
+func TestStaert_LintToml_upgrade(t *testing.T) {
+	type UnversionedConfig struct {
+		Name    string        `description:"Name"`
+		Section *AliasSection `description:"Section"`
+	}
+
+	testCases := []struct {
+		desc     string
+		file     string
+		config   interface{}
+		expected []string
+	}{
+		{
+			desc:   "version field",
+			file:   "./fixtures/upgrade.toml",
+			config: &UpgradeConfig{},
+			expected: []string{
+				"./fixtures/upgrade.toml:2: version: configuration version 1 is upgraded to 3",
+			},
+		},
+		{
+			desc:   "no version field",
+			file:   "./fixtures/upgrade.toml",
+			config: &UnversionedConfig{},
+			expected: []string{
+				"./fixtures/upgrade.toml:2: version: configuration version 1 is upgraded to 3",
+			},
+		},
+		{
+			desc:   "missing upgrade",
+			file:   "./fixtures/upgradeMissing.toml",
+			config: &UpgradeConfig{},
+			expected: []string{
+				"./fixtures/upgradeMissing.toml:2: no upgrade from configuration version 0",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			s, notices := newUpgradeStaert(&UpgradeConfig{})
+			s.command.Config = test.config
+			s.command.DefaultPointersConfig = deepCopy(test.config)
+
+			issues, err := s.LintToml(test.file)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, issue := range issues {
+				messages = append(messages, issue.String())
+			}
+			assert.Equal(t, test.expected, messages)
+			assert.Empty(t, *notices)
+		})
+	}
+}
+
+func TestLintKv(t *testing.T) {
+	pairs, err := ReadKvSnapshot("./fixtures/lintKvSnapshot.json")
+	require.NoError(t, err)
+
+	issues, err := LintKv(lintCommand(), pairs, "prefix")
+	require.NoError(t, err)
+
+	require.Len(t, issues, 2)
+	assert.Equal(t, "prefix/ptrstruct1/s1int", issues[0].Key)
+	assert.Contains(t, issues[0].Message, "cannot parse 'PtrStruct1.S1Int' as int")
+	assert.Equal(t, LintIssue{File: "kv", Key: "prefix/ptrstruct1/unknown", Message: "unknown key"}, issues[1])
+
+	delete(pairs, "prefix/ptrstruct1/s1int")
+	delete(pairs, "prefix/ptrstruct1/unknown")
+	issues, err = LintKv(lintCommand(), pairs, "prefix")
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+}
+
+func TestLintKvEmptyPrefix(t *testing.T) {
+	snapshot, err := ReadKvSnapshot("./fixtures/lintKvSnapshot.json")
+	require.NoError(t, err)
+	pairs := make(map[string]string)
+	for key, value := range snapshot {
+		pairs[strings.TrimPrefix(key, "prefix/")] = value
+	}
+
+	issues, err := LintKv(lintCommand(), pairs, "")
+	require.NoError(t, err)
+
+	require.Len(t, issues, 2)
+	assert.Equal(t, "ptrstruct1/s1int", issues[0].Key)
+	assert.Contains(t, issues[0].Message, "cannot parse 'PtrStruct1.S1Int' as int")
+	assert.Equal(t, LintIssue{File: "kv", Key: "ptrstruct1/unknown", Message: "unknown key"}, issues[1])
+}
+
+func TestNewLintCommand(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lintCmd := NewLintCommand(lintCommand(), buf)
+
+	err := flaeg.Load(lintCmd.Config, lintCmd.DefaultPointersConfig, []string{"--file=./fixtures/lintDeprecated.toml"})
+	require.NoError(t, err)
+
+	err = lintCmd.Run()
+	assert.EqualError(t, err, "2 issue(s) found")
+	assert.Equal(t, "./fixtures/lintDeprecated.toml:4: PtrStruct1.OldName: deprecated key: use S1String instead\n"+
+		"./fixtures/lintDeprecated.toml: validation failed: S1Int must be positive\n", buf.String())
+}
+
+func TestStaert_NewLintCommand(t *testing.T) {
+	s, _ := newAliasStaert(&AliasConfig{})
+	buf := &bytes.Buffer{}
+	lintCmd := s.NewLintCommand(buf)
+
+	err := flaeg.Load(lintCmd.Config, lintCmd.DefaultPointersConfig, []string{"--file=./fixtures/alias.toml"})
+	require.NoError(t, err)
+
+	err = lintCmd.Run()
+	assert.EqualError(t, err, "3 issue(s) found")
+	assert.Equal(t, "./fixtures/alias.toml:2: Old: deprecated key: use Name instead\n"+
+		"./fixtures/alias.toml:4: OldSection: deprecated key: use NewSection instead\n"+
+		"./fixtures/alias.toml:5: NewSection.OldName: deprecated key: use NewSection.NewName instead\n", buf.String())
+}
+
+func TestNewLintCommandNothingToLint(t *testing.T) {
+	lintCmd := NewLintCommand(lintCommand(), &bytes.Buffer{})
+	assert.Error(t, lintCmd.Run())
+}
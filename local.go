@@ -0,0 +1,69 @@
+package staert
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/abronan/valkeyrie"
+	"github.com/abronan/valkeyrie/store"
+	"github.com/abronan/valkeyrie/store/boltdb"
+)
+
+// DefaultLocalBucket is the BoltDB bucket used by NewLocalKvSource
+const DefaultLocalBucket = "staert"
+
+// The store.BOLTDB backend of NewKvSource is the valkeyrie BoltDB store with the in-process locks of localStore
+func init() {
+	valkeyrie.AddStore(store.BOLTDB, newLocalStore)
+}
+
+// localLocks are the in-process locks of the BoltDB files, by absolute path
+var localLocks = struct {
+	sync.Mutex
+	stores map[string]*MemoryStore
+}{stores: map[string]*MemoryStore{}}
+
+// localLocksOf returns the locks of the BoltDB file path, shared by all its localStores
+func localLocksOf(path string) *MemoryStore {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	localLocks.Lock()
+	defer localLocks.Unlock()
+
+	locks, ok := localLocks.stores[path]
+	if !ok {
+		locks = NewMemoryStore()
+		localLocks.stores[path] = locks
+	}
+	return locks
+}
+
+// localStore is a BoltDB store.Store which handles NewLock in-process, as BoltDB doesn't support it
+type localStore struct {
+	store.Store
+	locks *MemoryStore
+}
+
+// NewLock creates a lock for a given key, shared by the KvSources of this process using the same file only
+func (s *localStore) NewLock(key string, options *store.LockOptions) (store.Locker, error) {
+	return s.locks.NewLock(key, options)
+}
+
+func newLocalStore(addrs []string, options *store.Config) (store.Store, error) {
+	boltStore, err := boltdb.New(addrs, options)
+	if err != nil {
+		return nil, err
+	}
+	return &localStore{Store: boltStore, locks: localLocksOf(addrs[0])}, nil
+}
+
+// NewLocalKvSource creates a KvSource stored in a local BoltDB file (created if needed) in the DefaultLocalBucket bucket,
+// to use the same KV layout as a KV Store service without running one.
+// It's NewKvSource with the store.BOLTDB backend.
+// Locks (StoreConfigAtomic...) are only effective between the KvSources of the current process using the same file,
+// Watch and WatchTree are not supported.
+func NewLocalKvSource(path string, prefix string) (*KvSource, error) {
+	return NewKvSource(store.BOLTDB, []string{path}, &store.Config{Bucket: DefaultLocalBucket}, prefix)
+}
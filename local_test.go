@@ -0,0 +1,131 @@
+//go:build !race
+// +build !race
+
+// bbolt v1.3.0 (the last release importable by valkeyrie as "bolt") converts pointers unsafely,
+// which checkptr, enabled by the race detector since Go 1.14, reports as a fatal error
+
+package staert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalKvSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.db")
+
+	kv, err := NewLocalKvSource(path, "prefix")
+	require.NoError(t, err)
+
+	config := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:        1,
+			S1String:     "S1StringInitConfig",
+			S1PtrStruct3: &Struct3{S3Float64: 1.5},
+		},
+		DurationField: parse.Duration(21 * time.Second),
+	}
+	err = kv.StoreConfigAtomic(config)
+	require.NoError(t, err)
+	kv.Close()
+
+	// reopen the file
+	kv, err = NewLocalKvSource(path, "prefix")
+	require.NoError(t, err)
+	defer kv.Close()
+
+	loaded := &StructPtr{}
+	err = kv.LoadConfig(loaded)
+	require.NoError(t, err)
+	assert.Equal(t, config, loaded)
+
+	config.PtrStruct1.S1PtrStruct3 = nil
+	changes, err := kv.SyncConfig(config, false)
+	require.NoError(t, err)
+
+	expected := []KeyChange{
+		{Key: "prefix/ptrstruct1/s1ptrstruct3/", Type: KeyRemoved},
+		{Key: "prefix/ptrstruct1/s1ptrstruct3/s3float64", Type: KeyRemoved, OldValue: "1.5"},
+	}
+	assert.Equal(t, expected, changes)
+
+	loaded = &StructPtr{}
+	err = kv.LoadConfig(loaded)
+	require.NoError(t, err)
+	assert.Equal(t, config, loaded)
+}
+
+func TestLocalKvSourceLocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.db")
+	kv1, err := NewLocalKvSource(path, "prefix")
+	require.NoError(t, err)
+	defer kv1.Close()
+	kv2, err := NewLocalKvSource(filepath.Join(dir, ".", "config.db"), "prefix")
+	require.NoError(t, err)
+	defer kv2.Close()
+	other, err := NewLocalKvSource(filepath.Join(dir, "other.db"), "prefix")
+	require.NoError(t, err)
+	defer other.Close()
+
+	locker1, err := kv1.NewLock("prefix", nil)
+	require.NoError(t, err)
+	_, err = locker1.Lock(nil)
+	require.NoError(t, err)
+	defer locker1.Unlock()
+
+	stopCh := make(chan struct{})
+	close(stopCh)
+
+	// same file
+	locker2, err := kv2.NewLock("prefix", nil)
+	require.NoError(t, err)
+	_, err = locker2.Lock(stopCh)
+	assert.Equal(t, store.ErrCannotLock, err)
+
+	// another file
+	otherLocker, err := other.NewLock("prefix", nil)
+	require.NoError(t, err)
+	_, err = otherLocker.Lock(stopCh)
+	require.NoError(t, err)
+	assert.NoError(t, otherLocker.Unlock())
+}
+
+func TestLocalKvSourceBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.db")
+	kv, err := NewKvSource(store.BOLTDB, []string{path}, &store.Config{Bucket: DefaultLocalBucket}, "prefix")
+	require.NoError(t, err)
+	defer kv.Close()
+
+	config := &StructPtr{DurationField: parse.Duration(21 * time.Second)}
+	err = kv.StoreConfigAtomic(config)
+	require.NoError(t, err)
+
+	local, err := NewLocalKvSource(path, "prefix")
+	require.NoError(t, err)
+	defer local.Close()
+
+	loaded := &StructPtr{}
+	err = local.LoadConfig(loaded)
+	require.NoError(t, err)
+	assert.Equal(t, config, loaded)
+}
@@ -0,0 +1,408 @@
+package staert
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abronan/valkeyrie"
+	"github.com/abronan/valkeyrie/store"
+)
+
+// MEMORY is the backend of MemoryStore, it can be given to NewKvSource (addrs and options are ignored)
+const MEMORY store.Backend = "memory"
+
+func init() {
+	valkeyrie.AddStore(MEMORY, func(addrs []string, options *store.Config) (store.Store, error) {
+		return NewMemoryStore(), nil
+	})
+}
+
+var _ store.Store = (*MemoryStore)(nil)
+
+// MemoryStore is an in-memory store.Store, safe for concurrent use
+// It supports all the store.Store calls (TTL, Watch, WatchTree, AtomicPut, NewLock...)
+// Keys are handled as a tree : List, WatchTree and DeleteTree work on the keys under "<directory>/"
+type MemoryStore struct {
+	mu       sync.RWMutex
+	pairs    map[string]*memoryPair
+	index    uint64
+	watchers map[*memoryWatcher]struct{}
+	locks    map[string]*memoryLock
+	closed   bool
+}
+
+type memoryPair struct {
+	store.KVPair
+	expiration time.Time
+}
+
+func (p *memoryPair) expired() bool {
+	return !p.expiration.IsZero() && time.Now().After(p.expiration)
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		pairs:    map[string]*memoryPair{},
+		watchers: map[*memoryWatcher]struct{}{},
+		locks:    map[string]*memoryLock{},
+	}
+}
+
+func normalizeKey(key string) string {
+	return strings.TrimPrefix(key, "/")
+}
+
+// directoryPrefix returns the prefix of the keys under directory, "" for the root
+func directoryPrefix(directory string) string {
+	directory = strings.TrimSuffix(normalizeKey(directory), "/")
+	if len(directory) == 0 {
+		return ""
+	}
+	return directory + "/"
+}
+
+// Put a value at the specified key
+func (m *MemoryStore) Put(key string, value []byte, options *store.WriteOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.put(normalizeKey(key), value, options)
+	return nil
+}
+
+func (m *MemoryStore) put(key string, value []byte, options *store.WriteOptions) *store.KVPair {
+	m.index++
+	pair := &memoryPair{
+		KVPair: store.KVPair{
+			Key:       key,
+			Value:     append([]byte(nil), value...),
+			LastIndex: m.index,
+		},
+	}
+	if options != nil && options.TTL > 0 {
+		pair.expiration = time.Now().Add(options.TTL)
+	}
+	m.pairs[key] = pair
+	m.notify()
+	return copyPair(&pair.KVPair)
+}
+
+// get returns the pair of the key, nil if it doesn't exist or is expired
+func (m *MemoryStore) get(key string) *memoryPair {
+	pair, ok := m.pairs[key]
+	if !ok || pair.expired() {
+		return nil
+	}
+	return pair
+}
+
+func copyPair(pair *store.KVPair) *store.KVPair {
+	return &store.KVPair{
+		Key:       pair.Key,
+		Value:     append([]byte(nil), pair.Value...),
+		LastIndex: pair.LastIndex,
+	}
+}
+
+// Get a value given its key
+func (m *MemoryStore) Get(key string, options *store.ReadOptions) (*store.KVPair, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pair := m.get(normalizeKey(key))
+	if pair == nil {
+		return nil, store.ErrKeyNotFound
+	}
+	return copyPair(&pair.KVPair), nil
+}
+
+// Delete the value at the specified key
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key = normalizeKey(key)
+	if m.get(key) == nil {
+		return store.ErrKeyNotFound
+	}
+	delete(m.pairs, key)
+	m.notify()
+	return nil
+}
+
+// Exists verifies if a key exists in the store
+func (m *MemoryStore) Exists(key string, options *store.ReadOptions) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.get(normalizeKey(key)) != nil, nil
+}
+
+// List the content of a given directory, sorted by key
+func (m *MemoryStore) List(directory string, options *store.ReadOptions) ([]*store.KVPair, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pairs := m.list(directoryPrefix(directory))
+	if len(pairs) == 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+func (m *MemoryStore) list(prefix string) []*store.KVPair {
+	var pairs []*store.KVPair
+	for key := range m.pairs {
+		if pair := m.get(key); pair != nil && strings.HasPrefix(key, prefix) {
+			pairs = append(pairs, copyPair(&pair.KVPair))
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+	return pairs
+}
+
+// DeleteTree deletes the keys under a given directory
+func (m *MemoryStore) DeleteTree(directory string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix := directoryPrefix(directory)
+	for key := range m.pairs {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.pairs, key)
+		}
+	}
+	m.notify()
+	return nil
+}
+
+// AtomicPut puts a value at the specified key if it hasn't been modified since previous
+// Pass previous = nil to create a new key
+func (m *MemoryStore) AtomicPut(key string, value []byte, previous *store.KVPair, options *store.WriteOptions) (bool, *store.KVPair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key = normalizeKey(key)
+	current := m.get(key)
+	switch {
+	case previous == nil && current != nil:
+		return false, nil, store.ErrKeyExists
+	case previous != nil && current == nil:
+		return false, nil, store.ErrKeyNotFound
+	case previous != nil && previous.LastIndex != current.LastIndex:
+		return false, nil, store.ErrKeyModified
+	}
+	return true, m.put(key, value, options), nil
+}
+
+// AtomicDelete deletes the key if it hasn't been modified since previous
+func (m *MemoryStore) AtomicDelete(key string, previous *store.KVPair) (bool, error) {
+	if previous == nil {
+		return false, store.ErrPreviousNotSpecified
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key = normalizeKey(key)
+	current := m.get(key)
+	if current == nil {
+		return false, store.ErrKeyNotFound
+	}
+	if previous.LastIndex != current.LastIndex {
+		return false, store.ErrKeyModified
+	}
+	delete(m.pairs, key)
+	m.notify()
+	return true, nil
+}
+
+// Watch for changes on a key
+// The current value is sent first, if the key exists
+func (m *MemoryStore) Watch(key string, stopCh <-chan struct{}, options *store.ReadOptions) (<-chan *store.KVPair, error) {
+	key = normalizeKey(key)
+	out := make(chan *store.KVPair)
+	var last *store.KVPair
+	m.watch(stopCh, func() { close(out) }, func(stop <-chan struct{}) bool {
+		m.mu.RLock()
+		var pair *store.KVPair
+		if current := m.get(key); current != nil {
+			pair = copyPair(&current.KVPair)
+		}
+		m.mu.RUnlock()
+
+		if pair == nil || (last != nil && last.LastIndex == pair.LastIndex) {
+			return true
+		}
+		last = pair
+		select {
+		case out <- pair:
+			return true
+		case <-stop:
+			return false
+		}
+	})
+	return out, nil
+}
+
+// WatchTree watches for changes on the keys under a given directory
+// The current keys are sent first
+func (m *MemoryStore) WatchTree(directory string, stopCh <-chan struct{}, options *store.ReadOptions) (<-chan []*store.KVPair, error) {
+	prefix := directoryPrefix(directory)
+	out := make(chan []*store.KVPair)
+	var last []*store.KVPair
+	first := true
+	m.watch(stopCh, func() { close(out) }, func(stop <-chan struct{}) bool {
+		m.mu.RLock()
+		pairs := m.list(prefix)
+		m.mu.RUnlock()
+
+		if !first && samePairs(last, pairs) {
+			return true
+		}
+		first = false
+		last = pairs
+		select {
+		case out <- pairs:
+			return true
+		case <-stop:
+			return false
+		}
+	})
+	return out, nil
+}
+
+func samePairs(a, b []*store.KVPair) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key || a[i].LastIndex != b[i].LastIndex {
+			return false
+		}
+	}
+	return true
+}
+
+type memoryWatcher struct {
+	changed chan struct{}
+}
+
+// watch runs send at the beginning and after each change, until stopCh or the store is closed
+func (m *MemoryStore) watch(stopCh <-chan struct{}, done func(), send func(stop <-chan struct{}) bool) {
+	watcher := &memoryWatcher{changed: make(chan struct{}, 1)}
+	watcher.changed <- struct{}{}
+
+	m.mu.Lock()
+	closed := m.closed
+	if !closed {
+		m.watchers[watcher] = struct{}{}
+	}
+	m.mu.Unlock()
+	if closed {
+		done()
+		return
+	}
+
+	go func() {
+		defer func() {
+			m.mu.Lock()
+			delete(m.watchers, watcher)
+			m.mu.Unlock()
+			done()
+		}()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case _, ok := <-watcher.changed:
+				if !ok || !send(stopCh) {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// notify wakes up the watchers, it must be called holding the lock
+func (m *MemoryStore) notify() {
+	for watcher := range m.watchers {
+		select {
+		case watcher.changed <- struct{}{}:
+		default:
+			// a notification is already pending
+		}
+	}
+}
+
+// NewLock creates a lock for a given key
+// The returned Locker is not held and must be acquired with Lock
+func (m *MemoryStore) NewLock(key string, options *store.LockOptions) (store.Locker, error) {
+	return &memoryLocker{store: m, key: normalizeKey(key)}, nil
+}
+
+type memoryLock struct {
+	released chan struct{}
+}
+
+type memoryLocker struct {
+	store *MemoryStore
+	key   string
+	lock  *memoryLock
+}
+
+// Lock waits for the lock to be released by its holder, or for stopChan to be closed
+// The returned channel is closed when the lock is released
+func (l *memoryLocker) Lock(stopChan chan struct{}) (<-chan struct{}, error) {
+	for {
+		l.store.mu.Lock()
+		held, ok := l.store.locks[l.key]
+		if !ok {
+			l.lock = &memoryLock{released: make(chan struct{})}
+			l.store.locks[l.key] = l.lock
+			l.store.mu.Unlock()
+			return l.lock.released, nil
+		}
+		l.store.mu.Unlock()
+
+		select {
+		case <-held.released:
+		case <-stopChan:
+			return nil, store.ErrCannotLock
+		}
+	}
+}
+
+// Unlock releases the lock
+func (l *memoryLocker) Unlock() error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	if l.lock == nil || l.store.locks[l.key] != l.lock {
+		return store.ErrCannotLock
+	}
+	delete(l.store.locks, l.key)
+	close(l.lock.released)
+	l.lock = nil
+	return nil
+}
+
+// Close stops the watchers
+func (m *MemoryStore) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+	m.closed = true
+	for watcher := range m.watchers {
+		close(watcher.changed)
+	}
+	m.watchers = map[*memoryWatcher]struct{}{}
+}
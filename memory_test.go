@@ -0,0 +1,280 @@
+package staert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorePutGetDelete(t *testing.T) {
+	m := NewMemoryStore()
+
+	_, err := m.Get("prefix/vfoo", nil)
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	err = m.Put("prefix/vfoo", []byte("toto"), nil)
+	require.NoError(t, err)
+
+	pair, err := m.Get("/prefix/vfoo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, &store.KVPair{Key: "prefix/vfoo", Value: []byte("toto"), LastIndex: 1}, pair)
+
+	exists, err := m.Exists("prefix/vfoo", nil)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	err = m.Delete("prefix/vfoo")
+	require.NoError(t, err)
+
+	exists, err = m.Exists("prefix/vfoo", nil)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	err = m.Delete("prefix/vfoo")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	m := NewMemoryStore()
+
+	err := m.Put("prefix/vfoo", []byte("toto"), &store.WriteOptions{TTL: time.Millisecond})
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = m.Get("prefix/vfoo", nil)
+	assert.Equal(t, store.ErrKeyNotFound, err)
+}
+
+func TestMemoryStoreListDeleteTree(t *testing.T) {
+	m := NewMemoryStore()
+	for _, key := range []string{"prefix/d1/l1", "prefix/l1", "prefixother/l1", "prefix/d1/l2"} {
+		require.NoError(t, m.Put(key, []byte(key), nil))
+	}
+
+	pairs, err := m.List("prefix", nil)
+	require.NoError(t, err)
+
+	var keys []string
+	for _, pair := range pairs {
+		keys = append(keys, pair.Key)
+	}
+	assert.Equal(t, []string{"prefix/d1/l1", "prefix/d1/l2", "prefix/l1"}, keys)
+
+	err = m.DeleteTree("prefix/d1")
+	require.NoError(t, err)
+
+	pairs, err = m.List("prefix/", nil)
+	require.NoError(t, err)
+	require.Len(t, pairs, 1)
+	assert.Equal(t, "prefix/l1", pairs[0].Key)
+
+	_, err = m.List("unknown", nil)
+	assert.Equal(t, store.ErrKeyNotFound, err)
+}
+
+func TestMemoryStoreAtomicPut(t *testing.T) {
+	m := NewMemoryStore()
+
+	ok, created, err := m.AtomicPut("prefix/vfoo", []byte("toto"), nil, nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, _, err = m.AtomicPut("prefix/vfoo", []byte("tata"), nil, nil)
+	assert.Equal(t, store.ErrKeyExists, err)
+
+	ok, updated, err := m.AtomicPut("prefix/vfoo", []byte("tata"), created, nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "tata", string(updated.Value))
+
+	_, _, err = m.AtomicPut("prefix/vfoo", []byte("titi"), created, nil)
+	assert.Equal(t, store.ErrKeyModified, err)
+
+	_, err = m.AtomicDelete("prefix/vfoo", created)
+	assert.Equal(t, store.ErrKeyModified, err)
+
+	ok, err = m.AtomicDelete("prefix/vfoo", updated)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestMemoryStoreWatch(t *testing.T) {
+	m := NewMemoryStore()
+	require.NoError(t, m.Put("prefix/vfoo", []byte("toto"), nil))
+
+	stopCh := make(chan struct{})
+	events, err := m.Watch("prefix/vfoo", stopCh, nil)
+	require.NoError(t, err)
+
+	pair := <-events
+	assert.Equal(t, "toto", string(pair.Value))
+
+	require.NoError(t, m.Put("prefix/vfoo", []byte("tata"), nil))
+	pair = <-events
+	assert.Equal(t, "tata", string(pair.Value))
+
+	close(stopCh)
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestMemoryStoreWatchTree(t *testing.T) {
+	m := NewMemoryStore()
+	require.NoError(t, m.Put("prefix/vfoo", []byte("toto"), nil))
+
+	stopCh := make(chan struct{})
+	events, err := m.WatchTree("prefix", stopCh, nil)
+	require.NoError(t, err)
+
+	pairs := <-events
+	require.Len(t, pairs, 1)
+
+	require.NoError(t, m.Put("prefix/vbar", []byte("tata"), nil))
+	pairs = <-events
+	require.Len(t, pairs, 2)
+
+	m.Close()
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestMemoryStoreLock(t *testing.T) {
+	m := NewMemoryStore()
+
+	locker1, err := m.NewLock("prefix", nil)
+	require.NoError(t, err)
+	locker2, err := m.NewLock("prefix", nil)
+	require.NoError(t, err)
+
+	released, err := locker1.Lock(nil)
+	require.NoError(t, err)
+
+	stopCh := make(chan struct{})
+	close(stopCh)
+	_, err = locker2.Lock(stopCh)
+	assert.Equal(t, store.ErrCannotLock, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		_, err := locker2.Lock(nil)
+		assert.NoError(t, err)
+		close(acquired)
+	}()
+
+	require.NoError(t, locker1.Unlock())
+	<-released
+	<-acquired
+
+	require.NoError(t, locker2.Unlock())
+	assert.Equal(t, store.ErrCannotLock, locker2.Unlock())
+}
+
+func TestMemoryStoreKvSource(t *testing.T) {
+	kv, err := NewKvSource(MEMORY, nil, nil, "prefix")
+	require.NoError(t, err)
+
+	config := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:        1,
+			S1String:     "S1StringInitConfig",
+			S1PtrStruct3: &Struct3{S3Float64: 1.5},
+		},
+		DurationField: parse.Duration(21 * time.Second),
+	}
+	err = kv.StoreConfigAtomic(config)
+	require.NoError(t, err)
+
+	loaded := &StructPtr{}
+	err = kv.LoadConfig(loaded)
+	require.NoError(t, err)
+	assert.Equal(t, config, loaded)
+
+	config.PtrStruct1 = nil
+	changes, err := kv.SyncConfig(config, false)
+	require.NoError(t, err)
+	assert.Len(t, changes, 5)
+
+	pairs, err := kv.ListValuedPairWithPrefix("prefix")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"prefix/durationfield": []byte("21000000000")}, pairs)
+}
+
+func TestMemoryStoreKvSourceEmptyPrefix(t *testing.T) {
+	kv, err := NewKvSource(MEMORY, nil, nil, "")
+	require.NoError(t, err)
+
+	config := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:    1,
+			S1String: "S1StringInitConfig",
+		},
+		DurationField: parse.Duration(21 * time.Second),
+	}
+	err = kv.StoreConfig(config)
+	require.NoError(t, err)
+
+	loaded := &StructPtr{}
+	err = kv.LoadConfig(loaded)
+	require.NoError(t, err)
+	assert.Equal(t, config, loaded)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	events, err := kv.WatchTree("", stop, nil)
+	require.NoError(t, err)
+	pairs := <-events
+	assert.NotEmpty(t, pairs)
+}
+
+func TestMemoryStoreKvSourceLeadingSlash(t *testing.T) {
+	config := &struct {
+		Vfoo string
+		Vbar string
+	}{
+		Vfoo: "toto",
+		Vbar: "titi",
+	}
+
+	testCases := []struct {
+		desc   string
+		prefix string
+		keys   []string
+	}{
+		{
+			desc:   "leading slash in prefix",
+			prefix: "/prefix",
+			keys:   []string{"prefix/vfoo", "prefix/vold"},
+		},
+		{
+			desc:   "leading slash in keys",
+			prefix: "prefix",
+			keys:   []string{"/prefix/vfoo", "/prefix/vold"},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewMemoryStore()
+			require.NoError(t, m.Put(test.keys[0], []byte("toto"), nil))
+			require.NoError(t, m.Put(test.keys[1], []byte("tata"), nil))
+			kv := &KvSource{m, test.prefix}
+
+			changes, err := kv.SyncConfig(config, true)
+			require.NoError(t, err)
+
+			expected := []KeyChange{
+				{Key: "prefix/vbar", Type: KeyAdded, NewValue: "titi"},
+				{Key: "prefix/vold", Type: KeyRemoved, OldValue: "tata"},
+			}
+			assert.Equal(t, expected, changes)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package staert
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/containous/flaeg"
+)
+
+// VerificationError is returned by MigrateTomlToKv when the configuration read back from the KV Store
+// differs from the TOML one
+type VerificationError struct {
+	Changes []KeyChange // changes from the TOML configuration to the KV one
+}
+
+func (e *VerificationError) Error() string {
+	var changes []string
+	for _, c := range e.Changes {
+		changes = append(changes, c.String())
+	}
+	return fmt.Sprintf("configuration read from the KV Store differs from the TOML one: %s", strings.Join(changes, ", "))
+}
+
+// MigrateTomlToKv loads the configuration of cmd from the TOML source and stores it into the KV Store using StoreConfig
+// If dryRun is true, the KV Store is left untouched.
+// Otherwise the configuration is read back from the KV Store and compared with the TOML one,
+// a *VerificationError is returned if they differ.
+// It returns the keys added or modified in the KV Store (or which would be)
+func MigrateTomlToKv(cmd *flaeg.Command, ts *TomlSource, kv *KvSource, dryRun bool) ([]KeyChange, error) {
+	if _, err := ts.Parse(cmd); err != nil {
+		return nil, err
+	}
+	if ts.ConfigFileUsed() == "" {
+		return nil, errors.New("no TOML file found")
+	}
+
+	kvMap, err := collateKvUnderPrefix(cmd.Config, kv.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	current, err := kv.listKeysWithPrefix(kv.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []KeyChange
+	for _, c := range diffKv(current, kvMap) {
+		// StoreConfig doesn't remove any key
+		if c.Type != KeyRemoved {
+			changes = append(changes, c)
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+
+	if err := kv.StoreConfig(cmd.Config); err != nil {
+		return nil, err
+	}
+	return changes, verifyKvConfig(cmd.Config, kv)
+}
+
+func verifyKvConfig(config interface{}, kv *KvSource) error {
+	loaded := reflect.New(reflect.TypeOf(config).Elem()).Interface()
+	if err := kv.LoadConfig(loaded); err != nil {
+		return err
+	}
+
+	expectedKv, err := collateValuedKv(config)
+	if err != nil {
+		return err
+	}
+	loadedKv, err := collateValuedKv(loaded)
+	if err != nil {
+		return err
+	}
+
+	if changes := diffKv(expectedKv, loadedKv); len(changes) > 0 {
+		return &VerificationError{Changes: changes}
+	}
+	return nil
+}
+
+// collateValuedKv collates the config without the empty values, which are not loaded from a KV Store
+func collateValuedKv(config interface{}) (map[string]string, error) {
+	kvMap := map[string]string{}
+	if err := collateKvRecursive(reflect.ValueOf(config), kvMap, ""); err != nil {
+		return nil, err
+	}
+	for k, v := range kvMap {
+		if len(v) == 0 {
+			delete(kvMap, k)
+		}
+	}
+	return kvMap, nil
+}
@@ -0,0 +1,126 @@
+package staert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/containous/flaeg"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateTomlToKv(t *testing.T) {
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+	ts := NewTomlSource("trivial", []string{"./fixtures/"})
+	mock := &Mock{
+		KVPairs: []*store.KVPair{
+			{Key: "prefix/durationfield", Value: []byte("28000000000")},
+		},
+	}
+	kv := &KvSource{mock, "prefix"}
+
+	changes, err := MigrateTomlToKv(cmd, ts, kv, false)
+	require.NoError(t, err)
+
+	expectedChanges := []KeyChange{
+		{Key: "prefix/ptrstruct1/s1bool", Type: KeyAdded, NewValue: "true"},
+		{Key: "prefix/ptrstruct1/s1int", Type: KeyAdded, NewValue: "28"},
+		{Key: "prefix/ptrstruct1/s1string", Type: KeyAdded, NewValue: "S1StringDefaultPointersConfig"},
+	}
+	assert.Equal(t, expectedChanges, changes)
+
+	config := &StructPtr{}
+	err = kv.LoadConfig(config)
+	require.NoError(t, err)
+
+	expected := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:    28,
+			S1String: "S1StringDefaultPointersConfig",
+			S1Bool:   true,
+		},
+		DurationField: parse.Duration(28 * time.Second),
+	}
+	assert.Equal(t, expected, config)
+}
+
+func TestMigrateTomlToKvDryRun(t *testing.T) {
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+	ts := NewTomlSource("trivial", []string{"./fixtures/"})
+	mock := &Mock{}
+	kv := &KvSource{mock, "prefix"}
+
+	changes, err := MigrateTomlToKv(cmd, ts, kv, true)
+	require.NoError(t, err)
+
+	expectedChanges := []KeyChange{
+		{Key: "prefix/durationfield", Type: KeyAdded, NewValue: "28000000000"},
+		{Key: "prefix/ptrstruct1/s1bool", Type: KeyAdded, NewValue: "true"},
+		{Key: "prefix/ptrstruct1/s1int", Type: KeyAdded, NewValue: "28"},
+		{Key: "prefix/ptrstruct1/s1string", Type: KeyAdded, NewValue: "S1StringDefaultPointersConfig"},
+	}
+	assert.Equal(t, expectedChanges, changes)
+	assert.Empty(t, mock.KVPairs)
+}
+
+func TestMigrateTomlToKvFileNotFound(t *testing.T) {
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+	ts := NewTomlSource("nothing", []string{"/any/other/path"})
+	kv := &KvSource{&Mock{}, "prefix"}
+
+	_, err := MigrateTomlToKv(cmd, ts, kv, false)
+	assert.EqualError(t, err, "no TOML file found")
+}
+
+func TestVerifyKvConfig(t *testing.T) {
+	kv := &KvSource{
+		&Mock{
+			KVPairs: []*store.KVPair{
+				{Key: "prefix/ptrstruct1/s1int", Value: []byte("27")},
+			},
+		},
+		"prefix",
+	}
+	config := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int: 28,
+		},
+	}
+
+	err := verifyKvConfig(config, kv)
+	require.Error(t, err)
+
+	verificationErr, ok := err.(*VerificationError)
+	require.True(t, ok)
+
+	expected := []KeyChange{
+		{Key: "ptrstruct1/s1int", Type: KeyModified, OldValue: "28", NewValue: "27"},
+	}
+	assert.Equal(t, expected, verificationErr.Changes)
+}
@@ -0,0 +1,57 @@
+package staert
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ConfigPaths returns the standard directories of the configuration files of app, to give to NewTomlSource.
+// In order, the first file found being used:
+//   - $XDG_CONFIG_HOME/<app>
+//   - $HOME/.config/<app>
+//   - $XDG_CONFIG_DIRS/<app>, for each directory ($XDG_CONFIG_DIRS defaults to /etc/xdg)
+//   - /etc/<app>
+//   - the directory of the executable
+//
+// On Windows, they are %APPDATA%\<app>, %ProgramData%\<app> and the directory of the executable.
+// The directories of the unset variables are omitted
+func ConfigPaths(app string) []string {
+	var paths []string
+	addPath := func(dir string, elem ...string) {
+		if len(dir) == 0 {
+			return
+		}
+		path := filepath.Join(append([]string{dir}, elem...)...)
+		for _, p := range paths {
+			if p == path {
+				return
+			}
+		}
+		paths = append(paths, path)
+	}
+
+	if runtime.GOOS == "windows" {
+		addPath(os.Getenv("APPDATA"), app)
+		addPath(os.Getenv("ProgramData"), app)
+	} else {
+		addPath(os.Getenv("XDG_CONFIG_HOME"), app)
+		addPath(os.Getenv("HOME"), ".config", app)
+
+		configDirs := os.Getenv("XDG_CONFIG_DIRS")
+		if len(configDirs) == 0 {
+			configDirs = "/etc/xdg"
+		}
+		for _, dir := range strings.Split(configDirs, string(os.PathListSeparator)) {
+			addPath(dir, app)
+		}
+
+		addPath("/etc", app)
+	}
+
+	if executable, err := os.Executable(); err == nil {
+		addPath(filepath.Dir(executable))
+	}
+	return paths
+}
@@ -0,0 +1,92 @@
+package staert
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG directories are not used on Windows")
+	}
+
+	for _, key := range []string{"XDG_CONFIG_HOME", "XDG_CONFIG_DIRS", "HOME"} {
+		value, ok := os.LookupEnv(key)
+		if ok {
+			defer os.Setenv(key, value)
+		} else {
+			defer os.Unsetenv(key)
+		}
+	}
+
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	executableDir := filepath.Dir(executable)
+
+	testCases := []struct {
+		desc     string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			desc: "XDG variables",
+			env: map[string]string{
+				"XDG_CONFIG_HOME": "/home/user/config",
+				"XDG_CONFIG_DIRS": "/etc/xdg1:/etc/xdg2",
+				"HOME":            "/home/user",
+			},
+			expected: []string{
+				"/home/user/config/example",
+				"/home/user/.config/example",
+				"/etc/xdg1/example",
+				"/etc/xdg2/example",
+				"/etc/example",
+				executableDir,
+			},
+		},
+		{
+			desc: "defaults",
+			env: map[string]string{
+				"HOME": "/home/user",
+			},
+			expected: []string{
+				"/home/user/.config/example",
+				"/etc/xdg/example",
+				"/etc/example",
+				executableDir,
+			},
+		},
+		{
+			desc: "XDG_CONFIG_HOME is the default one",
+			env: map[string]string{
+				"XDG_CONFIG_HOME": "/home/user/.config",
+				"HOME":            "/home/user",
+			},
+			expected: []string{
+				"/home/user/.config/example",
+				"/etc/xdg/example",
+				"/etc/example",
+				executableDir,
+			},
+		},
+	}
+
+	// the tests modify the environment, they are not parallel
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			for _, key := range []string{"XDG_CONFIG_HOME", "XDG_CONFIG_DIRS", "HOME"} {
+				os.Unsetenv(key)
+			}
+			for key, value := range test.env {
+				os.Setenv(key, value)
+			}
+
+			assert.Equal(t, test.expected, ConfigPaths("example"))
+		})
+	}
+}
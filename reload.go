@@ -0,0 +1,63 @@
+package staert
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// ErrRestartRequired is returned by Reload when some changes require a restart and RefuseRestart is set
+var ErrRestartRequired = errors.New("configuration changes require a restart")
+
+// ReloadReport classifies the changes of a reload
+type ReloadReport struct {
+	Config  interface{} // the new config
+	Live    []KeyChange // changes which can be applied live
+	Restart []KeyChange // changes of the fields tagged `reload:"restart"` or under them
+}
+
+// RestartRequired returns true if some changes require a restart
+func (r *ReloadReport) RestartRequired() bool {
+	return len(r.Restart) > 0
+}
+
+// Reload loads a new config with LoadConfigCopy and compares it to the current config
+// The changes of the fields tagged `reload:"restart"`, and of the fields under them, require a restart.
+// If RefuseRestart is set and some changes require a restart, the report is returned with ErrRestartRequired
+func (s *Staert) Reload(current interface{}) (*ReloadReport, error) {
+	config, err := s.LoadConfigCopy()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := Diff(current, config)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReloadReport{Config: config}
+	configType := reflect.TypeOf(config)
+	for _, change := range changes {
+		if restartRequired(configType, change.Key) {
+			report.Restart = append(report.Restart, change)
+		} else {
+			report.Live = append(report.Live, change)
+		}
+	}
+
+	if s.RefuseRestart && report.RestartRequired() {
+		return report, ErrRestartRequired
+	}
+	return report, nil
+}
+
+// restartRequired returns true if a field of the KV key is tagged `reload:"restart"`
+func restartRequired(configType reflect.Type, key string) bool {
+	restart := false
+	walkConfigKey(configType, strings.Split(strings.TrimSuffix(key, "/"), "/"), false, func(field reflect.StructField) {
+		if field.Tag.Get("reload") == "restart" {
+			restart = true
+		}
+	})
+	return restart
+}
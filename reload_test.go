@@ -0,0 +1,104 @@
+package staert
+
+import (
+	"testing"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/containous/flaeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ReloadConfig struct {
+	Address  string        `description:"Address" reload:"restart"`
+	LogLevel string        `description:"Log level"`
+	TLS      *ReloadTLS    `description:"TLS" reload:"restart"`
+	Backend  *AliasSection `description:"Backend"`
+}
+
+type ReloadTLS struct {
+	Cert string `description:"Certificate"`
+}
+
+func newReloadStaert(pairs []*store.KVPair) *Staert {
+	rootCmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                &ReloadConfig{Address: ":80", LogLevel: "INFO"},
+		DefaultPointersConfig: &ReloadConfig{TLS: &ReloadTLS{}, Backend: &AliasSection{}},
+		Run: func() error {
+			return nil
+		},
+	}
+
+	s := NewStaert(rootCmd)
+	s.AddSource(&KvSource{&Mock{KVPairs: pairs}, "prefix"})
+	return s
+}
+
+func TestStaert_Reload(t *testing.T) {
+	current := &ReloadConfig{Address: ":80", LogLevel: "INFO"}
+
+	s := newReloadStaert([]*store.KVPair{
+		{Key: "prefix/address", Value: []byte(":443")},
+		{Key: "prefix/loglevel", Value: []byte("DEBUG")},
+		{Key: "prefix/tls/cert", Value: []byte("cert.pem")},
+		{Key: "prefix/backend/count", Value: []byte("2")},
+	})
+
+	report, err := s.Reload(current)
+	require.NoError(t, err)
+
+	expected := &ReloadConfig{
+		Address:  ":443",
+		LogLevel: "DEBUG",
+		TLS:      &ReloadTLS{Cert: "cert.pem"},
+		Backend:  &AliasSection{Count: 2},
+	}
+	assert.Equal(t, expected, report.Config)
+
+	expectedLive := []KeyChange{
+		{Key: "backend/", Type: KeyAdded},
+		{Key: "backend/count", Type: KeyAdded, NewValue: "2"},
+		{Key: "backend/newname", Type: KeyAdded},
+		{Key: "loglevel", Type: KeyModified, OldValue: "INFO", NewValue: "DEBUG"},
+	}
+	assert.Equal(t, expectedLive, report.Live)
+
+	expectedRestart := []KeyChange{
+		{Key: "address", Type: KeyModified, OldValue: ":80", NewValue: ":443"},
+		{Key: "tls/", Type: KeyAdded},
+		{Key: "tls/cert", Type: KeyAdded, NewValue: "cert.pem"},
+	}
+	assert.Equal(t, expectedRestart, report.Restart)
+	assert.True(t, report.RestartRequired())
+}
+
+func TestStaert_Reload_refuseRestart(t *testing.T) {
+	current := &ReloadConfig{Address: ":80", LogLevel: "INFO"}
+
+	s := newReloadStaert([]*store.KVPair{
+		{Key: "prefix/address", Value: []byte(":443")},
+	})
+	s.RefuseRestart = true
+
+	report, err := s.Reload(current)
+	assert.Equal(t, ErrRestartRequired, err)
+	require.NotNil(t, report)
+	assert.Len(t, report.Restart, 1)
+
+	h := NewHolder(current)
+	_, err = h.Reload(s)
+	assert.Equal(t, ErrRestartRequired, err)
+	assert.True(t, current == h.Get())
+
+	// live changes are accepted
+	s = newReloadStaert([]*store.KVPair{
+		{Key: "prefix/loglevel", Value: []byte("DEBUG")},
+	})
+	s.RefuseRestart = true
+
+	report, err = h.Reload(s)
+	require.NoError(t, err)
+	assert.False(t, report.RestartRequired())
+	assert.Equal(t, "DEBUG", h.Get().(*ReloadConfig).LogLevel)
+}
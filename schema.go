@@ -0,0 +1,191 @@
+package staert
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/containous/flaeg"
+)
+
+// JSONSchemaVersion is the JSON Schema draft used by GenerateJSONSchema
+const JSONSchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is a JSON Schema describing a configuration structure, to marshal with encoding/json
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+}
+
+// GenerateJSONSchema generates the JSON Schema of the command configuration, as loaded by TomlSource
+// Descriptions come from the "description" tags.
+// Defaults come from the command Config, and from DefaultPointersConfig for the fields under pointers
+// Values implementing encoding.TextUnmarshaler have no type, as any TOML primitive is accepted
+func GenerateJSONSchema(cmd *flaeg.Command) (*JSONSchema, error) {
+	if cmd.Config == nil {
+		return nil, fmt.Errorf("command %s has no config", cmd.Name)
+	}
+
+	// the root pointer gets the Config values, not the DefaultPointersConfig ones
+	value := indirectValue(reflect.ValueOf(cmd.Config))
+	if !value.IsValid() {
+		return nil, fmt.Errorf("command %s has a nil config", cmd.Name)
+	}
+	schema, err := generateJSONSchema(value.Type(), value, indirectValue(reflect.ValueOf(cmd.DefaultPointersConfig)), map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	schema.Schema = JSONSchemaVersion
+	schema.Title = cmd.Name
+	schema.Description = cmd.Description
+	return schema, nil
+}
+
+// generateJSONSchema generates the schema of typ, value and defaultPointersValue may be invalid
+func generateJSONSchema(typ reflect.Type, value reflect.Value, defaultPointersValue reflect.Value, visiting map[reflect.Type]bool) (*JSONSchema, error) {
+	textUnmarshalerType := reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	if typ.Kind() != reflect.Ptr && reflect.PtrTo(typ).Implements(textUnmarshalerType) {
+		return generateTextJSONSchema(value)
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return generatePointerJSONSchema(typ, value, defaultPointersValue, visiting)
+	case reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{}}
+		if err := generateStructJSONSchema(schema, typ, value, defaultPointersValue, visiting); err != nil {
+			return nil, err
+		}
+		return schema, nil
+	case reflect.Map:
+		elem, err := generateJSONSchema(typ.Elem(), reflect.Value{}, reflect.Value{}, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &JSONSchema{Type: "object", AdditionalProperties: elem}, nil
+	case reflect.Array, reflect.Slice:
+		// []byte included, as TomlSource reads it from an array of integers
+		elem, err := generateJSONSchema(typ.Elem(), reflect.Value{}, reflect.Value{}, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &JSONSchema{Type: "array", Items: elem}, nil
+	case reflect.Interface:
+		return &JSONSchema{}, nil
+	default:
+		return generatePrimitiveJSONSchema(typ, value)
+	}
+}
+
+// generateTextJSONSchema generates the schema of a value implementing encoding.TextUnmarshaler, without type
+func generateTextJSONSchema(value reflect.Value) (*JSONSchema, error) {
+	schema := &JSONSchema{}
+	if value.IsValid() {
+		defaultValue, err := tomlTree(value)
+		if err != nil {
+			return nil, err
+		}
+		schema.Default = defaultValue
+	}
+	return schema, nil
+}
+
+func generatePointerJSONSchema(typ reflect.Type, value reflect.Value, defaultPointersValue reflect.Value, visiting map[reflect.Type]bool) (*JSONSchema, error) {
+	// the fields under a pointer get the DefaultPointersConfig values
+	elemValue := indirectValue(defaultPointersValue)
+	if !elemValue.IsValid() {
+		elemValue = indirectValue(value)
+	}
+	if visiting[typ] {
+		return &JSONSchema{Type: "object"}, nil
+	}
+	visiting[typ] = true
+	defer delete(visiting, typ)
+	return generateJSONSchema(typ.Elem(), elemValue, indirectValue(defaultPointersValue), visiting)
+}
+
+func generatePrimitiveJSONSchema(typ reflect.Type, value reflect.Value) (*JSONSchema, error) {
+	schema := &JSONSchema{}
+	switch typ.Kind() {
+	case reflect.String:
+		schema.Type = "string"
+	case reflect.Bool:
+		schema.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema.Type = "integer"
+	case reflect.Float32, reflect.Float64:
+		schema.Type = "number"
+	default:
+		return nil, fmt.Errorf("kind %s not supported", typ.Kind().String())
+	}
+	if value.IsValid() {
+		schema.Default = value.Interface()
+	}
+	return schema, nil
+}
+
+func generateStructJSONSchema(schema *JSONSchema, typ reflect.Type, value reflect.Value, defaultPointersValue reflect.Value, visiting map[reflect.Type]bool) error {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			//if unexported field
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		fieldValue := fieldByIndex(value, i)
+		fieldDefaultPointersValue := fieldByIndex(defaultPointersValue, i)
+
+		// the fields of embedded structs are promoted
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := generateStructJSONSchema(schema, field.Type, fieldValue, fieldDefaultPointersValue, visiting); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema, err := generateJSONSchema(field.Type, fieldValue, fieldDefaultPointersValue, visiting)
+		if err != nil {
+			return err
+		}
+		fieldSchema.Description = field.Tag.Get("description")
+		schema.Properties[name] = fieldSchema
+	}
+	return nil
+}
+
+// indirectValue returns the value pointed by value, an invalid value if it is nil
+func indirectValue(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// fieldByIndex returns the i-th field of the struct value, an invalid value if the struct value is invalid
+func fieldByIndex(value reflect.Value, i int) reflect.Value {
+	if !value.IsValid() {
+		return value
+	}
+	return value.Field(i)
+}
@@ -0,0 +1,119 @@
+package staert
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/containous/flaeg"
+	"github.com/containous/flaeg/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateJSONSchema(t *testing.T) {
+	rootCmd := &flaeg.Command{
+		Name:        "test",
+		Description: "description test",
+		Config: &StructPtr{
+			PtrStruct1: &Struct1{
+				S1Int:    1,
+				S1String: "S1StringInitConfig",
+			},
+			DurationField: parse.Duration(28 * time.Second),
+		},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run:                   func() error { return nil },
+	}
+
+	schema, err := GenerateJSONSchema(rootCmd)
+	require.NoError(t, err)
+
+	out, err := json.Marshal(schema)
+	require.NoError(t, err)
+
+	expected := `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "test",
+		"description": "description test",
+		"type": "object",
+		"properties": {
+			"PtrStruct1": {
+				"description": "Enable Struct1",
+				"type": "object",
+				"properties": {
+					"S1Int": {"description": "Struct 1 Int", "type": "integer", "default": 11},
+					"S1String": {"description": "Struct 1 String", "type": "string", "default": "S1StringDefaultPointersConfig"},
+					"S1Bool": {"description": "Struct 1 Bool", "type": "boolean", "default": true},
+					"S1PtrStruct3": {
+						"description": "Enable Struct3",
+						"type": "object",
+						"properties": {
+							"S3Float64": {"description": "Struct 3 float64", "type": "number", "default": 11.11}
+						}
+					}
+				}
+			},
+			"PtrStruct2": {
+				"description": "Enable Struct1",
+				"type": "object",
+				"properties": {
+					"S2Int64": {"description": "Struct 2 Int64", "type": "integer", "default": 22},
+					"S2String": {"description": "Struct 2 String", "type": "string", "default": "S2StringDefaultPointersConfig"},
+					"S2Bool": {"description": "Struct 2 Bool", "type": "boolean", "default": false}
+				}
+			},
+			"DurationField": {"description": "Duration Field", "default": "28s"}
+		}
+	}`
+	assert.JSONEq(t, expected, string(out))
+}
+
+func TestGenerateJSONSchemaContainers(t *testing.T) {
+	type Embedded struct {
+		EmbeddedString string `description:"embedded"`
+	}
+	type Config struct {
+		Embedded
+		Renamed  string             `toml:"renamed"`
+		Ignored  string             `toml:"-"`
+		Slice    []int              `description:"slice"`
+		Bytes    []byte             `description:"bytes"`
+		Map      map[string]Struct3 `description:"map"`
+		Any      interface{}
+		internal string
+	}
+
+	schema, err := GenerateJSONSchema(&flaeg.Command{Name: "test", Config: &Config{Renamed: "foo"}})
+	require.NoError(t, err)
+
+	out, err := json.Marshal(schema)
+	require.NoError(t, err)
+
+	expected := `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "test",
+		"type": "object",
+		"properties": {
+			"EmbeddedString": {"description": "embedded", "type": "string", "default": ""},
+			"renamed": {"type": "string", "default": "foo"},
+			"Slice": {"description": "slice", "type": "array", "items": {"type": "integer"}},
+			"Bytes": {"description": "bytes", "type": "array", "items": {"type": "integer"}},
+			"Map": {
+				"description": "map",
+				"type": "object",
+				"additionalProperties": {
+					"type": "object",
+					"properties": {"S3Float64": {"description": "Struct 3 float64", "type": "number"}}
+				}
+			},
+			"Any": {}
+		}
+	}`
+	assert.JSONEq(t, expected, string(out))
+}
+
+func TestGenerateJSONSchemaNoConfig(t *testing.T) {
+	_, err := GenerateJSONSchema(&flaeg.Command{Name: "test"})
+	assert.Error(t, err)
+}
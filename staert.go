@@ -3,6 +3,7 @@ package staert
 import (
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/containous/flaeg"
 )
@@ -16,11 +17,115 @@ type Source interface {
 type Staert struct {
 	command *flaeg.Command
 	sources []Source
+
+	// ContinueOnError makes LoadConfig parse all the sources even if some fail,
+	// their errors are then returned in a *SourcesError
+	ContinueOnError bool
+
+	// OnDeprecatedKey is called when a source uses the old key of a key alias (see AddKeyAlias),
+	// the warning is logged if it is nil
+	OnDeprecatedKey func(warning DeprecatedKeyWarning)
+
+	// VersionKey is the key of the configuration version, used by the upgrades (see AddUpgrade)
+	VersionKey string
+	// OnUpgrade is called when a source is upgraded to the current configuration version,
+	// the notice is logged if it is nil
+	OnUpgrade func(notice UpgradeNotice)
+
+	// ConfigFileFlag is the name of the flag (like "configfile") holding the file loaded by the TomlSources,
+	// instead of the files they search. Its value is parsed from the flaeg source args before the sources
+	ConfigFileFlag string
+
+	// RefuseRestart makes Reload refuse the configs with changes requiring a restart
+	RefuseRestart bool
+
+	// OnBeforeSource is called before each source is parsed, with the config merged so far in cmd.Config
+	// An error is returned as the error of the source
+	OnBeforeSource func(src Source, cmd *flaeg.Command) error
+	// OnAfterSource is called after each source is successfully parsed, with the config merged so far in cmd.Config
+	// An error is returned as the error of the source
+	OnAfterSource func(src Source, cmd *flaeg.Command) error
+	// OnLoaded is called once all the sources are successfully parsed
+	OnLoaded func(cmd *flaeg.Command) error
+
+	aliases  []keyAlias
+	upgrades map[int]UpgradeFunc
+	// copies of the Config and DefaultPointersConfig of the commands, taken before they are first loaded
+	defaults map[*flaeg.Command]*flaeg.Command
+}
+
+// SourceError is the error returned by a source
+type SourceError struct {
+	Index  int // index of the source, in the order of AddSource
+	Source Source
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("source %d (%T): %v", e.Index, e.Source, e.Err)
+}
+
+// Unwrap returns the error of the source
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// SourcesError aggregates the errors of all the failing sources
+type SourcesError struct {
+	Errors []*SourceError
+}
+
+func (e *SourcesError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d source(s) failed: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the errors of the sources
+func (e *SourcesError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// As finds the first error of the sources, or error wrapped by them, which matches target (a pointer on an error type)
+// and sets target to it. errors.As uses it before Go 1.20, which ignores Unwrap() []error
+func (e *SourcesError) As(target interface{}) bool {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
+		return false
+	}
+	targetType := targetValue.Type().Elem()
+
+	for _, sourceErr := range e.Errors {
+		for err := error(sourceErr); err != nil; err = unwrapError(err) {
+			if reflect.TypeOf(err).AssignableTo(targetType) {
+				targetValue.Elem().Set(reflect.ValueOf(err))
+				return true
+			}
+			if as, ok := err.(interface{ As(interface{}) bool }); ok && as.As(target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unwrapError returns the error wrapped by err, nil if none
+func unwrapError(err error) error {
+	if wrapper, ok := err.(interface{ Unwrap() error }); ok {
+		return wrapper.Unwrap()
+	}
+	return nil
 }
 
 // NewStaert creates and return a pointer on Staert. Need defaultConfig and defaultPointersConfig given by references
 func NewStaert(rootCommand *flaeg.Command) *Staert {
-	return &Staert{command: rootCommand}
+	return &Staert{command: rootCommand, VersionKey: DefaultVersionKey}
 }
 
 // AddSource adds new Source to Staert, give it by reference
@@ -31,45 +136,145 @@ func (s *Staert) AddSource(src Source) {
 // LoadConfig check which command is called and parses config
 // It returns the the parsed config or an error if it fails
 func (s *Staert) LoadConfig() (interface{}, error) {
+	cmd, flg, err := s.findCommand()
+	if err != nil {
+		return nil, err
+	}
+	s.command = cmd
+	s.commandDefaults(cmd)
+
+	if flg != nil {
+		// (not parseAllSources)
+		s.command, err = flg.Parse(cmd)
+		return s.command.Config, err
+	}
+	err = s.parseConfigAllSources(s.command)
+	return s.command.Config, err
+}
+
+// LoadConfigCopy check which command is called and parses config like LoadConfig,
+// but into a deep copy of the command Config as it was before the first LoadConfig or LoadConfigCopy, holding the default values:
+// the keys removed from the sources since get their default values back.
+// It returns the parsed copy or an error if it fails: the command Config is never modified,
+// so a failing reload leaves the running config untouched.
+func (s *Staert) LoadConfigCopy() (interface{}, error) {
+	cmd, flg, err := s.findCommand()
+	if err != nil {
+		return nil, err
+	}
+	s.command = cmd
+
+	defaults := s.commandDefaults(cmd)
+	cmdCopy := *cmd
+	cmdCopy.Config = deepCopy(defaults.Config)
+	cmdCopy.DefaultPointersConfig = deepCopy(defaults.DefaultPointersConfig)
+
+	if flg != nil {
+		// (not parseAllSources)
+		_, err = flg.Parse(&cmdCopy)
+	} else {
+		err = s.parseConfigAllSources(&cmdCopy)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cmdCopy.Config, nil
+}
+
+// commandDefaults returns the copies of the Config and DefaultPointersConfig of cmd taken before it is first loaded
+func (s *Staert) commandDefaults(cmd *flaeg.Command) *flaeg.Command {
+	if defaults, ok := s.defaults[cmd]; ok {
+		return defaults
+	}
+	if s.defaults == nil {
+		s.defaults = make(map[*flaeg.Command]*flaeg.Command)
+	}
+	defaults := &flaeg.Command{Config: deepCopy(cmd.Config), DefaultPointersConfig: deepCopy(cmd.DefaultPointersConfig)}
+	s.defaults[cmd] = defaults
+	return defaults
+}
+
+// findCommand returns the called command
+// If it is a flaeg sub-command which doesn't parse all sources, it returns the flaeg source to parse it with
+func (s *Staert) findCommand() (*flaeg.Command, *flaeg.Flaeg, error) {
+	cmd := s.command
 	for _, src := range s.sources {
 		// Type assertion
 		if flg, ok := src.(*flaeg.Flaeg); ok {
 			fCmd, err := flg.GetCommand()
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			// if fleag sub-command
-			if s.command != fCmd {
+			if cmd != fCmd {
 				// if parseAllSources
 				if fCmd.Metadata["parseAllSources"] == "true" {
 					fCmdConfigType := reflect.TypeOf(fCmd.Config)
-					sCmdConfigType := reflect.TypeOf(s.command.Config)
+					sCmdConfigType := reflect.TypeOf(cmd.Config)
 					if fCmdConfigType != sCmdConfigType {
-						return nil, fmt.Errorf("command %s : Config type doesn't match with root command config type. Expected %s got %s",
+						return nil, nil, fmt.Errorf("command %s : Config type doesn't match with root command config type. Expected %s got %s",
 							fCmd.Name, sCmdConfigType.Name(), fCmdConfigType.Name())
 					}
-					s.command = fCmd
+					cmd = fCmd
 				} else {
 					// (not parseAllSources)
-					s.command, err = flg.Parse(fCmd)
-					return s.command.Config, err
+					return fCmd, flg, nil
 				}
 			}
 		}
 	}
-	err := s.parseConfigAllSources(s.command)
-	return s.command.Config, err
+	return cmd, nil, nil
 }
 
 // parseConfigAllSources getConfig for a flaeg.Command run sources Parse func in the raw
+// If ContinueOnError is set, all the sources are parsed and their errors returned in a *SourcesError
 func (s *Staert) parseConfigAllSources(cmd *flaeg.Command) error {
-	for _, src := range s.sources {
-		_, err := src.Parse(cmd)
+	if err := s.setConfigFile(cmd); err != nil {
+		return err
+	}
+
+	sourcesErr := &SourcesError{}
+	for i, src := range s.sources {
+		err := s.parseSource(src, cmd)
 		if err != nil {
+			if !s.ContinueOnError {
+				return err
+			}
+			sourcesErr.Errors = append(sourcesErr.Errors, &SourceError{Index: i, Source: src, Err: err})
+		}
+	}
+	if len(sourcesErr.Errors) > 0 {
+		return sourcesErr
+	}
+
+	if s.OnLoaded != nil {
+		return s.OnLoaded(cmd)
+	}
+	return nil
+}
+
+// parseSource parses a source, between the OnBeforeSource and OnAfterSource hooks
+func (s *Staert) parseSource(src Source, cmd *flaeg.Command) error {
+	if s.OnBeforeSource != nil {
+		if err := s.OnBeforeSource(src, cmd); err != nil {
 			return err
 		}
 	}
+
+	var err error
+	if rewritable, ok := src.(rewritableSource); ok && (len(s.aliases) > 0 || len(s.upgrades) > 0) {
+		_, err = rewritable.parseRewritten(cmd, s.rewriteTree)
+	} else {
+		_, err = src.Parse(cmd)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.OnAfterSource != nil {
+		return s.OnAfterSource(src, cmd)
+	}
 	return nil
 }
 
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/abronan/valkeyrie/store"
 	"github.com/containous/flaeg"
 	"github.com/containous/flaeg/parse"
 	"github.com/stretchr/testify/assert"
@@ -99,6 +101,72 @@ func Test_parseConfigAllSources_propagateError(t *testing.T) {
 	require.Error(t, err)
 }
 
+func Test_parseConfigAllSources_continueOnError(t *testing.T) {
+	config := &StructPtr{}
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                config,
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	s := NewStaert(cmd)
+	s.ContinueOnError = true
+
+	toml := NewTomlSource("typeError", []string{"./fixtures/"})
+	s.AddSource(&ErrorSource{})
+	s.AddSource(NewTomlSource("fieldUnderPointer", []string{"./fixtures/"}))
+	s.AddSource(toml)
+
+	err := s.parseConfigAllSources(cmd)
+	require.Error(t, err)
+
+	sourcesErr, ok := err.(*SourcesError)
+	require.True(t, ok)
+	require.Len(t, sourcesErr.Errors, 2)
+
+	assert.Equal(t, 0, sourcesErr.Errors[0].Index)
+	assert.EqualError(t, sourcesErr.Errors[0].Err, "fail")
+
+	assert.Equal(t, 2, sourcesErr.Errors[1].Index)
+	assert.Equal(t, toml, sourcesErr.Errors[1].Source)
+
+	var tomlErr *TomlError
+	require.True(t, sourcesErr.As(&tomlErr))
+	assert.Equal(t, "PtrStruct1.S1Int", tomlErr.Key)
+
+	// the sources after a failing one are parsed
+	assert.Equal(t, parse.Duration(42*time.Second), config.DurationField)
+	assert.True(t, config.PtrStruct1.S1Bool)
+	assert.True(t, strings.HasPrefix(err.Error(), "2 source(s) failed: source 0 (*staert.ErrorSource): fail; source 2 (*staert.TomlSource): "))
+}
+
+func TestSourcesError_As(t *testing.T) {
+	tomlErr := &TomlError{File: "file.toml", Key: "PtrStruct1.S1Int", Err: errors.New("type error")}
+	err := &SourcesError{Errors: []*SourceError{
+		{Index: 0, Err: errors.New("fail")},
+		{Index: 1, Err: tomlErr},
+	}}
+
+	var sourceErr *SourceError
+	require.True(t, err.As(&sourceErr))
+	assert.Equal(t, 0, sourceErr.Index)
+
+	var foundTomlErr *TomlError
+	require.True(t, err.As(&foundTomlErr))
+	assert.Equal(t, tomlErr, foundTomlErr)
+
+	var writeErr *PartialWriteError
+	assert.False(t, err.As(&writeErr))
+	assert.Nil(t, writeErr)
+
+	assert.False(t, err.As(nil))
+	assert.False(t, err.As(sourceErr))
+}
+
 func Test_parseConfigAllSources_mergeFlaegWithoutArgsAndEmptyToml(t *testing.T) {
 	config := &StructPtr{
 		PtrStruct1: &Struct1{
@@ -941,3 +1009,251 @@ func TestLoadConfig_flaegTomlSubCommandParseAllSourcesShouldError(t *testing.T)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "Config type doesn't match with root command config type.")
 }
+
+func TestLoadConfig_hooks(t *testing.T) {
+	config := &StructPtr{}
+	rootCmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                config,
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	s := NewStaert(rootCmd)
+	toml := NewTomlSource("trivial", []string{"./fixtures/"})
+	s.AddSource(toml)
+	fs := flaeg.New(rootCmd, []string{"--ptrstruct1.s1int=55"})
+	s.AddSource(fs)
+
+	var calls []string
+	s.OnBeforeSource = func(src Source, cmd *flaeg.Command) error {
+		calls = append(calls, fmt.Sprintf("before %T", src))
+		return nil
+	}
+	s.OnAfterSource = func(src Source, cmd *flaeg.Command) error {
+		calls = append(calls, fmt.Sprintf("after %T", src))
+		// normalize the TOML values before the flags
+		if src == toml {
+			assert.Equal(t, 28, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+			cmd.Config.(*StructPtr).PtrStruct1.S1String = strings.ToUpper(cmd.Config.(*StructPtr).PtrStruct1.S1String)
+		}
+		return nil
+	}
+	s.OnLoaded = func(cmd *flaeg.Command) error {
+		calls = append(calls, "loaded")
+		assert.Equal(t, 55, cmd.Config.(*StructPtr).PtrStruct1.S1Int)
+		return nil
+	}
+
+	_, err := s.LoadConfig()
+	require.NoError(t, err)
+
+	expected := []string{
+		"before *staert.TomlSource",
+		"after *staert.TomlSource",
+		"before *flaeg.Flaeg",
+		"after *flaeg.Flaeg",
+		"loaded",
+	}
+	assert.Equal(t, expected, calls)
+	assert.Equal(t, "S1STRINGDEFAULTPOINTERSCONFIG", config.PtrStruct1.S1String)
+}
+
+func TestLoadConfig_hooksErrors(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		onBeforeSource func(src Source, cmd *flaeg.Command) error
+		onAfterSource  func(src Source, cmd *flaeg.Command) error
+		onLoaded       func(cmd *flaeg.Command) error
+		expectedCalls  int
+	}{
+		{
+			desc: "OnBeforeSource",
+			onBeforeSource: func(src Source, cmd *flaeg.Command) error {
+				return errors.New("hook error")
+			},
+		},
+		{
+			desc: "OnAfterSource",
+			onAfterSource: func(src Source, cmd *flaeg.Command) error {
+				return errors.New("hook error")
+			},
+			expectedCalls: 1,
+		},
+		{
+			desc: "OnLoaded",
+			onLoaded: func(cmd *flaeg.Command) error {
+				return errors.New("hook error")
+			},
+			expectedCalls: 2,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			rootCmd := &flaeg.Command{
+				Name:                  "test",
+				Config:                &StructPtr{},
+				DefaultPointersConfig: defaultPointersConfig(),
+				Run: func() error {
+					return nil
+				},
+			}
+
+			calls := 0
+			counter := &sourceFunc{func(cmd *flaeg.Command) (*flaeg.Command, error) {
+				calls++
+				return cmd, nil
+			}}
+
+			s := NewStaert(rootCmd)
+			s.AddSource(counter)
+			s.AddSource(counter)
+			s.OnBeforeSource = test.onBeforeSource
+			s.OnAfterSource = test.onAfterSource
+			s.OnLoaded = test.onLoaded
+
+			_, err := s.LoadConfig()
+			assert.EqualError(t, err, "hook error")
+			assert.Equal(t, test.expectedCalls, calls)
+		})
+	}
+}
+
+type sourceFunc struct {
+	parse func(cmd *flaeg.Command) (*flaeg.Command, error)
+}
+
+func (s *sourceFunc) Parse(cmd *flaeg.Command) (*flaeg.Command, error) {
+	return s.parse(cmd)
+}
+
+func TestLoadConfigCopy(t *testing.T) {
+	config := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:    1,
+			S1String: "S1StringInitConfig",
+		},
+		DurationField: parse.Duration(time.Second),
+	}
+	rootCmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                config,
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	s := NewStaert(rootCmd)
+	s.AddSource(NewTomlSource("trivial", []string{"./fixtures/"}))
+	s.AddSource(flaeg.New(rootCmd, []string{"--ptrstruct1.s1string=S1StringFlaeg"}))
+
+	loaded, err := s.LoadConfigCopy()
+	require.NoError(t, err)
+
+	expected := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:    28,
+			S1String: "S1StringFlaeg",
+			S1Bool:   true,
+		},
+		DurationField: parse.Duration(28 * time.Second),
+	}
+	assert.Equal(t, expected, loaded)
+
+	// the command Config holds the defaults
+	expectedDefaults := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:    1,
+			S1String: "S1StringInitConfig",
+		},
+		DurationField: parse.Duration(time.Second),
+	}
+	assert.Equal(t, expectedDefaults, config)
+	assert.Equal(t, defaultPointersConfig(), rootCmd.DefaultPointersConfig)
+
+	// a failing reload returns no config
+	s.AddSource(&ErrorSource{})
+	loaded, err = s.LoadConfigCopy()
+	require.Error(t, err)
+	assert.Nil(t, loaded)
+	assert.Equal(t, expectedDefaults, config)
+}
+
+func TestLoadConfigCopy_deletedKeys(t *testing.T) {
+	type MapConfig struct {
+		Vfoo string            `description:"Vfoo"`
+		Vmap map[string]string `description:"Vmap"`
+	}
+
+	config := &MapConfig{Vfoo: "default"}
+	rootCmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                config,
+		DefaultPointersConfig: &MapConfig{},
+		Run: func() error {
+			return nil
+		},
+	}
+
+	memory := NewMemoryStore()
+	require.NoError(t, memory.Put("prefix/vfoo", []byte("kv"), nil))
+	require.NoError(t, memory.Put("prefix/vmap/k1", []byte("v1"), nil))
+	require.NoError(t, memory.Put("prefix/vmap/k2", []byte("v2"), nil))
+
+	s := NewStaert(rootCmd)
+	s.AddSource(&KvSource{memory, "prefix"})
+
+	_, err := s.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, &MapConfig{Vfoo: "kv", Vmap: map[string]string{"k1": "v1", "k2": "v2"}}, config)
+
+	require.NoError(t, memory.Delete("prefix/vmap/k2"))
+	require.NoError(t, memory.Delete("prefix/vfoo"))
+
+	// the deleted keys get their default values back
+	loaded, err := s.LoadConfigCopy()
+	require.NoError(t, err)
+	assert.Equal(t, &MapConfig{Vfoo: "default", Vmap: map[string]string{"k1": "v1"}}, loaded)
+
+	// the running config is untouched
+	assert.Equal(t, &MapConfig{Vfoo: "kv", Vmap: map[string]string{"k1": "v1", "k2": "v2"}}, config)
+}
+
+func TestLoadConfigCopy_kvPointerReset(t *testing.T) {
+	config := &StructPtr{
+		PtrStruct1: &Struct1{S1Int: 1},
+	}
+	rootCmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                config,
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	s := NewStaert(rootCmd)
+	s.AddSource(&KvSource{
+		&Mock{
+			KVPairs: []*store.KVPair{
+				{Key: "prefix/ptrstruct1/s1string", Value: []byte("S1StringKv")},
+			},
+		},
+		"prefix",
+	})
+
+	loaded, err := s.LoadConfigCopy()
+	require.NoError(t, err)
+
+	assert.Equal(t, "S1StringKv", loaded.(*StructPtr).PtrStruct1.S1String)
+	assert.Equal(t, &StructPtr{PtrStruct1: &Struct1{S1Int: 1}}, config)
+}
@@ -1,9 +1,19 @@
 package staert
 
 import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/BurntSushi/toml"
 	"github.com/containous/flaeg"
@@ -13,16 +23,23 @@ var _ Source = (*TomlSource)(nil)
 
 // TomlSource implement staert.Source
 type TomlSource struct {
+	// Extensions are the extensions of the file searched in the directories, in order, ".toml" if empty
+	// The file is decoded according to its extension (see FileExtensions), as TOML if unknown
+	Extensions []string
+
 	filename     string
 	dirNFullPath []string
 	fullPath     string
+	configFile   string // set by Staert from its ConfigFileFlag, searched instead of dirNFullPath
+	attempts     []SearchAttempt
 }
 
 // NewTomlSource creates and return a pointer on Source.
-// Parameter filename is the file name (without extension type, ".toml" will be added)
+// Parameter filename is the file name (without extension type, the Extensions will be added)
 // dirNFullPath may contain directories or fullPath to the file.
+// The file name and the paths may be glob patterns, the first file matching is used.
 func NewTomlSource(filename string, dirNFullPath []string) *TomlSource {
-	return &TomlSource{filename, dirNFullPath, ""}
+	return &TomlSource{filename: filename, dirNFullPath: dirNFullPath}
 }
 
 // ConfigFileUsed return config file used
@@ -30,18 +47,79 @@ func (ts *TomlSource) ConfigFileUsed() string {
 	return ts.fullPath
 }
 
+// SearchAttempts returns the paths tried by the last Parse to find the file, in order
+func (ts *TomlSource) SearchAttempts() []SearchAttempt {
+	return ts.attempts
+}
+
 // Parse calls toml.DecodeFile() func
 func (ts *TomlSource) Parse(cmd *flaeg.Command) (*flaeg.Command, error) {
-	ts.fullPath = findFile(ts.filename, ts.dirNFullPath)
-	if len(ts.fullPath) < 2 {
-		return cmd, nil
+	return ts.parseRewritten(cmd, nil)
+}
+
+// parseRewritten parses the TOML file like Parse, rewriting the raw key tree with rewrite before decoding it
+func (ts *TomlSource) parseRewritten(cmd *flaeg.Command, rewrite treeRewriter) (*flaeg.Command, error) {
+	var err error
+	if len(ts.configFile) > 0 {
+		// the file given on the command line must exist
+		ts.fullPath, ts.attempts = findFile(ts.filename, []string{ts.configFile}, ts.Extensions...)
+		if len(ts.fullPath) < 2 {
+			for _, attempt := range ts.attempts {
+				if attempt.Err != nil {
+					return nil, fmt.Errorf("config file %s not found: %v", ts.configFile, attempt.Err)
+				}
+			}
+			return nil, fmt.Errorf("config file %s not found", ts.configFile)
+		}
+	} else {
+		ts.fullPath, ts.attempts = findFile(ts.filename, ts.dirNFullPath, ts.Extensions...)
+		if len(ts.fullPath) < 2 {
+			return cmd, nil
+		}
 	}
 
-	metadata, err := toml.DecodeFile(ts.fullPath, cmd.Config)
+	data, err := ioutil.ReadFile(ts.fullPath)
 	if err != nil {
 		return nil, err
 	}
 
+	format := formatFromExtension(filepath.Ext(ts.fullPath))
+	if len(format) == 0 || format == FormatToml {
+		return parseToml(cmd, ts.fullPath, data, rewrite)
+	}
+	data, err = convertToToml(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid %s document: %v", ts.fullPath, format, err)
+	}
+	return parseConvertedToml(cmd, ts.fullPath, data, rewrite)
+}
+
+// parseToml decodes the TOML document data of file into the command config, like TomlSource does,
+// rewriting the raw key tree with rewrite, if not nil, before decoding it
+// The errors of a rewritten document are located in the original document data
+func parseToml(cmd *flaeg.Command, file string, data []byte, rewrite treeRewriter) (*flaeg.Command, error) {
+	original := data
+	var raw *rawTree
+	if rewrite != nil {
+		var err error
+		data, raw, err = rewriteToml(file, data, rewrite)
+		if err != nil {
+			return nil, err
+		}
+	}
+	locateError := func(err error) *TomlError {
+		tomlErr := newTomlError(file, data, cmd.Config, err)
+		if raw != nil {
+			relocateTomlError(tomlErr, original, raw)
+		}
+		return tomlErr
+	}
+
+	metadata, err := toml.Decode(string(data), cmd.Config)
+	if err != nil {
+		return nil, locateError(err)
+	}
+
 	boolFlags, err := flaeg.GetBoolFlags(cmd.Config)
 	if err != nil {
 		return nil, err
@@ -51,38 +129,186 @@ func (ts *TomlSource) Parse(cmd *flaeg.Command) (*flaeg.Command, error) {
 
 	err = flaeg.Load(cmd.Config, cmd.DefaultPointersConfig, flgArgs)
 	if err != nil && err != flaeg.ErrParserNotFound {
-		return nil, err
+		return nil, &TomlError{File: file, Err: err}
 	}
 
 	if hasUnderField {
-		_, err := toml.DecodeFile(ts.fullPath, cmd.Config)
+		_, err := toml.Decode(string(data), cmd.Config)
 		if err != nil {
-			return nil, err
+			return nil, locateError(err)
 		}
 	}
 
 	return cmd, nil
 }
 
+// rewriteToml rewrites the raw key tree of the TOML document data of file
+// The document is returned unchanged with a nil tree if rewrite doesn't change the tree,
+// else the new document is returned with the rewritten tree
+func rewriteToml(file string, data []byte, rewrite treeRewriter) ([]byte, *rawTree, error) {
+	tree := make(map[string]interface{})
+	if _, err := toml.Decode(string(data), &tree); err != nil {
+		// the error is located when decoding the document into the config
+		return data, nil, nil
+	}
+
+	lines := tomlKeyLines(data)
+	raw := &rawTree{tree: tree, source: "toml"}
+	raw.location = func(key []string) string {
+		if line, ok := lines[raw.origin(strings.Join(key, "."))]; ok {
+			return file + ":" + strconv.Itoa(line)
+		}
+		return file
+	}
+	changed, err := rewrite(raw)
+	if err != nil || !changed {
+		return data, nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(tree); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), raw, nil
+}
+
+// relocateTomlError locates tomlErr, an error of the document rewritten from raw, in the original document data
+// The line and column are 0 if the key isn't in the original document
+func relocateTomlError(tomlErr *TomlError, data []byte, raw *rawTree) {
+	tomlErr.Line, tomlErr.Column = 0, 0
+	if len(tomlErr.Key) == 0 {
+		return
+	}
+	key := raw.origin(tomlErr.Key)
+	if line, ok := tomlKeyLines(data)[key]; ok {
+		parts := splitTomlKey(key)
+		tomlErr.Line = line
+		tomlErr.Column = tomlKeyColumn(data, line, parts[len(parts)-1])
+	}
+}
+
 func preProcessDir(dirIn string) (string, error) {
 	return filepath.Abs(os.ExpandEnv(dirIn))
 }
 
-func findFile(filename string, dirNFile []string) string {
+// SearchAttempt is a path tried by TomlSource to find its file
+type SearchAttempt struct {
+	Path  string // absolute path, or the path as given if it can't be resolved
+	Found bool
+	Err   error // error resolving or checking the path, nil if it doesn't exist
+}
+
+func (a SearchAttempt) String() string {
+	switch {
+	case a.Err != nil:
+		return fmt.Sprintf("%s: %v", a.Path, a.Err)
+	case a.Found:
+		return a.Path + ": found"
+	default:
+		return a.Path + ": not found"
+	}
+}
+
+// findFile returns the first file of dirNFile, which may contain directories (searched for filename with the extensions,
+// ".toml" if none), files or glob patterns of files, "" if none is found, with the paths tried
+// The first file matching a pattern, in lexical order, is used. The files matching the patterns of dirNFile must have one of the extensions.
+// The paths which can't be resolved or checked are skipped, their error is recorded in their SearchAttempt
+func findFile(filename string, dirNFile []string, extensions ...string) (string, []SearchAttempt) {
+	if len(extensions) == 0 {
+		extensions = []string{".toml"}
+	}
+
+	var attempts []SearchAttempt
 	for _, df := range dirNFile {
-		if df != "" {
-			fullPath, _ := preProcessDir(df)
-			if fileInfo, err := os.Stat(fullPath); err == nil && !fileInfo.IsDir() {
-				return fullPath
+		if df == "" {
+			continue
+		}
+
+		fullPath, err := preProcessDir(df)
+		if err != nil {
+			attempts = append(attempts, SearchAttempt{Path: df, Err: err})
+			continue
+		}
+
+		var candidates []string
+		var candidateExtensions []string
+		if fileInfo, err := os.Stat(fullPath); err == nil && fileInfo.IsDir() {
+			for _, extension := range extensions {
+				candidates = append(candidates, filepath.Join(fullPath, filename+extension))
 			}
+		} else {
+			candidates = []string{fullPath}
+			candidateExtensions = extensions
+		}
 
-			fullPath = filepath.Join(fullPath, filename+".toml")
-			if fileInfo, err := os.Stat(fullPath); err == nil && !fileInfo.IsDir() {
-				return fullPath
+		for _, candidate := range candidates {
+			attempt := findCandidate(candidate, candidateExtensions)
+			attempts = append(attempts, attempt)
+			if attempt.Found {
+				return attempt.Path, attempts
 			}
 		}
 	}
-	return ""
+	return "", attempts
+}
+
+// findCandidate checks the file path, or the first file matching the glob pattern path with one of the extensions (any if nil)
+// The attempt of a pattern holds the error of the first match which can't be checked, if none is found
+func findCandidate(path string, extensions []string) SearchAttempt {
+	if !hasGlobMeta(path) {
+		return checkFile(path)
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return SearchAttempt{Path: path, Err: err}
+	}
+	var matchErr error
+	for _, match := range matches {
+		if extensions != nil && !hasExtension(match, extensions) {
+			continue
+		}
+		attempt := checkFile(match)
+		if attempt.Found {
+			return attempt
+		}
+		if attempt.Err != nil && matchErr == nil {
+			matchErr = attempt.Err
+		}
+	}
+	return SearchAttempt{Path: path, Err: matchErr}
+}
+
+// checkFile checks the file path exists
+func checkFile(path string) SearchAttempt {
+	fileInfo, err := os.Stat(path)
+	switch {
+	case err == nil && !fileInfo.IsDir():
+		return SearchAttempt{Path: path, Found: true}
+	case err == nil || os.IsNotExist(err) || isNotDir(err):
+		return SearchAttempt{Path: path}
+	default:
+		return SearchAttempt{Path: path, Err: err}
+	}
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+func hasExtension(path string, extensions []string) bool {
+	for _, extension := range extensions {
+		if strings.EqualFold(filepath.Ext(path), extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotDir returns true if err is due to a file in a path, used as a directory
+func isNotDir(err error) bool {
+	pathErr, ok := err.(*os.PathError)
+	return ok && pathErr.Err == syscall.ENOTDIR
 }
 
 func generateArgs(metadata toml.MetaData, flags []string) ([]string, bool) {
@@ -115,3 +341,296 @@ func generateArgs(metadata toml.MetaData, flags []string) ([]string, bool) {
 
 	return flgArgs, hasUnderField
 }
+
+// EncodeToml writes the config as a TOML document which can be loaded by TomlSource
+// Nil pointers are omitted, not nil pointers are written as tables, []byte as arrays of integers
+// and values implementing encoding.TextMarshaler as strings
+func EncodeToml(config interface{}, w io.Writer) error {
+	tree, err := tomlTree(reflect.ValueOf(config))
+	if err != nil {
+		return err
+	}
+	if tree == nil {
+		return nil
+	}
+	return toml.NewEncoder(w).Encode(tree)
+}
+
+// tomlTree converts the value into a tree of maps, slices and TOML primitives, nil if the value must be omitted
+func tomlTree(value reflect.Value) (interface{}, error) {
+	if !value.IsValid() {
+		return nil, nil
+	}
+
+	if text, ok, err := marshalTomlText(value); ok || err != nil {
+		return text, err
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil, nil
+		}
+		return tomlTree(value.Elem())
+	case reflect.Struct:
+		tree := make(map[string]interface{})
+		if err := tomlStructTree(value, tree); err != nil {
+			return nil, err
+		}
+		return tree, nil
+	case reflect.Map:
+		return tomlMapTree(value)
+	case reflect.Array, reflect.Slice:
+		return tomlSliceTree(value)
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return value.Interface(), nil
+	default:
+		return nil, fmt.Errorf("kind %s not supported", value.Kind().String())
+	}
+}
+
+// marshalTomlText returns the text of the values implementing encoding.TextMarshaler, false for the other values
+func marshalTomlText(value reflect.Value) (string, bool, error) {
+	marshalable := value
+	if marshalable.Kind() != reflect.Ptr && marshalable.Kind() != reflect.Interface {
+		// the marshaler may be implemented on the pointer
+		marshalable = reflect.New(value.Type())
+		marshalable.Elem().Set(value)
+	}
+	if marshalable.Kind() == reflect.Ptr && marshalable.IsNil() {
+		return "", false, nil
+	}
+	marshaler, ok := marshalable.Interface().(encoding.TextMarshaler)
+	if !ok {
+		return "", false, nil
+	}
+	text, err := marshaler.MarshalText()
+	return string(text), true, err
+}
+
+func tomlMapTree(value reflect.Value) (interface{}, error) {
+	tree := make(map[string]interface{})
+	for _, k := range value.MapKeys() {
+		v, err := tomlTree(value.MapIndex(k))
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			tree[fmt.Sprint(k)] = v
+		}
+	}
+	return tree, nil
+}
+
+// tomlSliceTree converts the slices and arrays, []byte included as TomlSource reads it from an array of integers
+func tomlSliceTree(value reflect.Value) (interface{}, error) {
+	var tree []interface{}
+	for i := 0; i < value.Len(); i++ {
+		v, err := tomlTree(value.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			tree = append(tree, v)
+		}
+	}
+	return tree, nil
+}
+
+func tomlStructTree(value reflect.Value, tree map[string]interface{}) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		switch {
+		case name == "-":
+		case name == "" && field.Anonymous && value.Field(i).Kind() == reflect.Struct:
+			// the fields of embedded structs are promoted
+			if err := tomlStructTree(value.Field(i), tree); err != nil {
+				return err
+			}
+		case field.PkgPath != "":
+			//if unexported field
+		default:
+			if name == "" {
+				name = field.Name
+			}
+			v, err := tomlTree(value.Field(i))
+			if err != nil {
+				return err
+			}
+			if v != nil {
+				tree[name] = v
+			}
+		}
+	}
+	return nil
+}
+
+// TomlError is an error of TomlSource, located in the TOML file
+type TomlError struct {
+	File   string
+	Line   int    // 0 if unknown
+	Column int    // 0 if unknown
+	Key    string // TOML key, like "PtrStruct1.S1Int", empty if unknown
+	Field  string // Go field path, like "PtrStruct1.S1Int", empty if unknown
+	Err    error
+}
+
+func (e *TomlError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			location += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	switch {
+	case len(e.Key) == 0:
+		return fmt.Sprintf("%s: %v", location, e.Err)
+	case len(e.Field) == 0:
+		return fmt.Sprintf("%s: key %s: %v", location, e.Key, e.Err)
+	default:
+		return fmt.Sprintf("%s: key %s (field %s): %v", location, e.Key, e.Field, e.Err)
+	}
+}
+
+// Unwrap returns the TOML decoder or flaeg error
+func (e *TomlError) Unwrap() error {
+	return e.Err
+}
+
+var tomlParseErrorRegexp = regexp.MustCompile(`^Near line (\d+) \(last key parsed '(.*)'\)`)
+
+// newTomlError locates the error err of the TOML document data of file, decoded into config
+// Parse errors hold their line, the key of a type error is found by decoding the keys one by one
+func newTomlError(file string, data []byte, config interface{}, err error) *TomlError {
+	tomlErr := &TomlError{File: file, Err: err}
+	configType := reflect.TypeOf(config).Elem()
+	lines := tomlKeyLines(data)
+
+	var key toml.Key
+	if match := tomlParseErrorRegexp.FindStringSubmatch(err.Error()); match != nil {
+		tomlErr.Line, _ = strconv.Atoi(match[1])
+		// the last parsed key is only the failing one if it is on the failing line
+		if lines[match[2]] == tomlErr.Line {
+			key = splitTomlKey(match[2])
+		}
+	} else {
+		key = findTomlErrorKey(data, configType, err)
+		tomlErr.Line = lines[key.String()]
+	}
+
+	if len(key) > 0 {
+		tomlErr.Key = key.String()
+		tomlErr.Field, _, _ = resolveConfigKey(configType, key, true)
+		tomlErr.Column = tomlKeyColumn(data, tomlErr.Line, key[len(key)-1])
+	}
+	return tomlErr
+}
+
+// findTomlErrorKey returns the key of the TOML document data which fails with err when decoded into configType,
+// else the first key which can't be decoded, nil if none
+func findTomlErrorKey(data []byte, configType reflect.Type, err error) toml.Key {
+	tree := make(map[string]interface{})
+	metadata, decodeErr := toml.Decode(string(data), &tree)
+	if decodeErr != nil {
+		return nil
+	}
+
+	var firstKey toml.Key
+	for _, key := range metadata.Keys() {
+		if metadata.Type(key...) == "Hash" || metadata.Type(key...) == "ArrayHash" {
+			continue
+		}
+		value, ok := tomlTreeValue(tree, key)
+		if !ok {
+			continue
+		}
+		keyErr := decodeTomlValue(configType, key, value)
+		if keyErr == nil {
+			continue
+		}
+		if keyErr.Error() == err.Error() {
+			return key
+		}
+		if firstKey == nil {
+			firstKey = key
+		}
+	}
+	return firstKey
+}
+
+// tomlKeyColumn returns the column of name in the line of the TOML document data, 0 if not found
+func tomlKeyColumn(data []byte, line int, name string) int {
+	lines := strings.Split(string(data), "\n")
+	if line < 1 || line > len(lines) {
+		return 0
+	}
+	return strings.Index(lines[line-1], name) + 1
+}
+
+// tomlKeyLines returns the line of the tables and keys of a TOML document, by dotted key
+func tomlKeyLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	var table []string
+	multiline := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		// skip the multi-line strings content
+		if multiline != "" {
+			if strings.Count(text, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+
+		var key string
+		key, table, multiline = tomlLineKey(text, table)
+		if _, ok := lines[key]; len(key) > 0 && !ok {
+			lines[key] = line
+		}
+	}
+	return lines
+}
+
+// tomlLineKey returns the key defined by the line text in table (empty if none), the table of the next lines,
+// and the delimiter of the multi-line string started by the line
+func tomlLineKey(text string, table []string) (string, []string, string) {
+	switch {
+	case text == "" || strings.HasPrefix(text, "#"):
+		return "", table, ""
+	case strings.HasPrefix(text, "["):
+		end := strings.Index(text, "]")
+		if end < 0 {
+			return "", table, ""
+		}
+		table = splitTomlKey(strings.Trim(text[:end], "[ "))
+		return strings.Join(table, "."), table, ""
+	}
+
+	equal := strings.Index(text, "=")
+	if equal < 0 {
+		return "", table, ""
+	}
+	key := strings.Join(append(append([]string{}, table...), splitTomlKey(text[:equal])...), ".")
+	multiline := ""
+	for _, delimiter := range []string{`"""`, `'''`} {
+		if strings.Count(text[equal:], delimiter)%2 == 1 {
+			multiline = delimiter
+		}
+	}
+	return key, table, multiline
+}
+
+func splitTomlKey(key string) []string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"'`)
+	}
+	return parts
+}
@@ -1,6 +1,8 @@
 package staert
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -269,6 +271,82 @@ func TestTomlSource_Parse_Pointer(t *testing.T) {
 	assert.Exactly(t, expected, cmd.Config)
 }
 
+func TestTomlSource_Parse_Errors(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		filename      string
+		expected      *TomlError
+		expectedError string
+	}{
+		{
+			desc:     "type error",
+			filename: "typeError",
+			expected: &TomlError{Line: 4, Column: 3, Key: "PtrStruct1.S1Int", Field: "PtrStruct1.S1Int"},
+			expectedError: "typeError.toml:4:3: key PtrStruct1.S1Int (field PtrStruct1.S1Int): " +
+				"toml: cannot load TOML value of type string into a Go integer",
+		},
+		{
+			desc:     "text unmarshaler error",
+			filename: "durationError",
+			expected: &TomlError{Line: 2, Column: 1, Key: "DurationField", Field: "DurationField"},
+			expectedError: `durationError.toml:2:1: key DurationField (field DurationField): ` +
+				`time: unknown unit " seconds" in duration "28 seconds"`,
+		},
+		{
+			desc:     "syntax error",
+			filename: "lintSyntax",
+			expected: &TomlError{Line: 4, Column: 1, Key: "PtrStruct1.S1String", Field: "PtrStruct1.S1String"},
+			expectedError: "lintSyntax.toml:4:1: key PtrStruct1.S1String (field PtrStruct1.S1String): " +
+				"Near line 4 (last key parsed 'PtrStruct1.S1String'): strings cannot contain newlines",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			src := NewTomlSource(test.filename, []string{"./fixtures/"})
+			cmd := &flaeg.Command{
+				Name:                  "test",
+				Config:                &StructPtr{},
+				DefaultPointersConfig: defaultPointersConfig(),
+				Run: func() error {
+					return nil
+				},
+			}
+
+			_, err := src.Parse(cmd)
+			require.Error(t, err)
+
+			tomlErr, ok := err.(*TomlError)
+			require.True(t, ok, "expected a *TomlError, got %T", err)
+			assert.Equal(t, src.ConfigFileUsed(), tomlErr.File)
+			assert.Equal(t, test.expected.Line, tomlErr.Line)
+			assert.Equal(t, test.expected.Column, tomlErr.Column)
+			assert.Equal(t, test.expected.Key, tomlErr.Key)
+			assert.Equal(t, test.expected.Field, tomlErr.Field)
+			assert.Equal(t, tomlErr.Err, tomlErr.Unwrap())
+			assert.Equal(t, filepath.Join(filepath.Dir(tomlErr.File), test.expectedError), err.Error())
+		})
+	}
+}
+
+func Test_tomlKeyLines(t *testing.T) {
+	data := []byte(`# comment
+a = 1
+s = """
+b = 2
+"""
+[t1 . "t2"]
+c = 3
+[[arr]]
+d = 4
+`)
+	expected := map[string]int{"a": 2, "s": 3, "t1.t2": 6, "t1.t2.c": 7, "arr": 8, "arr.d": 9}
+	assert.Equal(t, expected, tomlKeyLines(data))
+}
+
 func Test_preProcessDir(t *testing.T) {
 	here, err := filepath.Abs(".")
 	require.NoError(t, err)
@@ -330,15 +408,23 @@ func Test_findFile(t *testing.T) {
 
 	expected := filepath.Join(here, "fixtures", "nothing.toml")
 
-	result := findFile("nothing", []string{"", "$HOME/test", "fixtures"})
+	result, attempts := findFile("nothing", []string{"", "$HOME/test", "fixtures"})
 	assert.Equal(t, expected, result)
+
+	homeTest, err := filepath.Abs(os.ExpandEnv("$HOME/test"))
+	require.NoError(t, err)
+	expectedAttempts := []SearchAttempt{
+		{Path: homeTest},
+		{Path: expected, Found: true},
+	}
+	assert.Equal(t, expectedAttempts, attempts)
 }
 
 func Test_findFile_sliceFileAndDirLastIf(t *testing.T) {
 	thisPath, _ := filepath.Abs(".")
 	expected := filepath.Join(thisPath, "/fixtures/trivial.toml")
 
-	result := findFile("trivial", []string{"./fixtures/", "/any/other/path"})
+	result, _ := findFile("trivial", []string{"./fixtures/", "/any/other/path"})
 	assert.Equal(t, expected, result)
 }
 
@@ -349,6 +435,247 @@ func Test_findFile_sliceFileAndDirFirstIf(t *testing.T) {
 	thisPath, _ := filepath.Abs(".")
 	expected := filepath.Join(thisPath, "/fixtures/nothing.toml")
 
-	result := findFile(inFilename, inDirNfile)
+	result, _ := findFile(inFilename, inDirNfile)
 	assert.Equal(t, expected, result)
 }
+
+func Test_findFile_notFound(t *testing.T) {
+	thisPath, _ := filepath.Abs(".")
+
+	result, attempts := findFile("missing", []string{"./fixtures/", "./fixtures/trivial.toml/sub"})
+	assert.Empty(t, result)
+
+	expectedAttempts := []SearchAttempt{
+		{Path: filepath.Join(thisPath, "fixtures", "missing.toml")},
+		{Path: filepath.Join(thisPath, "fixtures", "trivial.toml", "sub")},
+	}
+	assert.Equal(t, expectedAttempts, attempts)
+}
+
+func Test_findFile_error(t *testing.T) {
+	thisPath, _ := filepath.Abs(".")
+	expected := filepath.Join(thisPath, "fixtures", "trivial.toml")
+
+	// the paths which can't be checked are skipped
+	result, attempts := findFile("trivial", []string{"/invalid\x00path", "./fixtures/"})
+	assert.Equal(t, expected, result)
+
+	require.Len(t, attempts, 2)
+	assert.Equal(t, "/invalid\x00path", attempts[0].Path)
+	assert.Error(t, attempts[0].Err)
+	assert.Equal(t, SearchAttempt{Path: expected, Found: true}, attempts[1])
+}
+
+func TestTomlSource_SearchAttempts(t *testing.T) {
+	src := NewTomlSource("trivial", []string{"/any/other/path", "./fixtures/"})
+
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+	_, err := src.Parse(cmd)
+	require.NoError(t, err)
+
+	thisPath, _ := filepath.Abs(".")
+	expected := []string{
+		"/any/other/path: not found",
+		filepath.Join(thisPath, "fixtures", "trivial.toml") + ": found",
+	}
+
+	var attempts []string
+	for _, attempt := range src.SearchAttempts() {
+		attempts = append(attempts, attempt.String())
+	}
+	assert.Equal(t, expected, attempts)
+	assert.Equal(t, filepath.Join(thisPath, "fixtures", "trivial.toml"), src.ConfigFileUsed())
+}
+
+func TestEncodeToml(t *testing.T) {
+	config := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:        28,
+			S1String:     "S1StringToml",
+			S1PtrStruct3: &Struct3{},
+		},
+		DurationField: parse.Duration(28 * time.Second),
+	}
+
+	buffer := &bytes.Buffer{}
+	err := EncodeToml(config, buffer)
+	require.NoError(t, err)
+
+	expected := `DurationField = "28s"
+
+[PtrStruct1]
+  S1Bool = false
+  S1Int = 28
+  S1String = "S1StringToml"
+  [PtrStruct1.S1PtrStruct3]
+    S3Float64 = 0.0
+`
+	assert.Equal(t, expected, buffer.String())
+}
+
+func TestEncodeTomlRoundTrip(t *testing.T) {
+	config := &StructPtr{
+		PtrStruct1: &Struct1{
+			S1Int:        28,
+			S1String:     "S1StringToml",
+			S1PtrStruct3: &Struct3{},
+		},
+		PtrStruct2: &Struct2{
+			S2Int64: 22,
+		},
+		DurationField: parse.Duration(28 * time.Second),
+	}
+
+	dir, err := ioutil.TempDir("", "staert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file, err := os.Create(filepath.Join(dir, "export.toml"))
+	require.NoError(t, err)
+	err = EncodeToml(config, file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Description:           "description test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	_, err = NewTomlSource("export", []string{dir}).Parse(cmd)
+	require.NoError(t, err)
+
+	assert.Equal(t, config, cmd.Config)
+}
+
+func TestTomlSource_Parse_Extensions(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		filename   string
+		dirs       []string
+		extensions []string
+		expected   *Struct1
+	}{
+		{
+			desc:       "JSON",
+			filename:   "app",
+			dirs:       []string{"./fixtures/formats/json"},
+			extensions: FileExtensions,
+			expected:   &Struct1{S1Int: 28, S1String: "S1StringJson", S1Bool: true},
+		},
+		{
+			desc:       "YAML",
+			filename:   "app",
+			dirs:       []string{"./fixtures/formats/yaml"},
+			extensions: FileExtensions,
+			expected:   &Struct1{S1Int: 28, S1String: "S1StringYaml", S1Bool: true},
+		},
+		{
+			desc:       "TML",
+			filename:   "app",
+			dirs:       []string{"./fixtures/formats/tml"},
+			extensions: FileExtensions,
+			expected:   &Struct1{S1Int: 28, S1String: "S1StringTml", S1Bool: true},
+		},
+		{
+			desc:       "extensions order",
+			filename:   "app",
+			dirs:       []string{"./fixtures/formats/both"},
+			extensions: []string{".json", ".toml"},
+			expected:   &Struct1{S1Int: 2, S1String: "S1StringJson", S1Bool: true},
+		},
+		{
+			desc:     "TOML only by default",
+			filename: "app",
+			dirs:     []string{"./fixtures/formats/json", "./fixtures/formats/both"},
+			expected: &Struct1{S1Int: 1, S1String: "S1StringToml", S1Bool: true},
+		},
+		{
+			desc:       "glob path",
+			dirs:       []string{"./fixtures/formats/conf.d/*"},
+			extensions: FileExtensions,
+			expected:   &Struct1{S1Int: 10, S1String: "S1String10", S1Bool: true},
+		},
+		{
+			desc:       "glob path with extension",
+			dirs:       []string{"./fixtures/formats/conf.d/*.toml"},
+			extensions: FileExtensions,
+			expected:   &Struct1{S1Int: 20, S1String: "S1String20", S1Bool: true},
+		},
+		{
+			desc:     "glob file name",
+			filename: "2*",
+			dirs:     []string{"./fixtures/formats/conf.d"},
+			expected: &Struct1{S1Int: 20, S1String: "S1String20", S1Bool: true},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			src := NewTomlSource(test.filename, test.dirs)
+			src.Extensions = test.extensions
+
+			cmd := &flaeg.Command{
+				Name:                  "test",
+				Config:                &StructPtr{},
+				DefaultPointersConfig: defaultPointersConfig(),
+				Run: func() error {
+					return nil
+				},
+			}
+
+			_, err := src.Parse(cmd)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, cmd.Config.(*StructPtr).PtrStruct1)
+		})
+	}
+}
+
+func TestTomlSource_Parse_ConvertedError(t *testing.T) {
+	src := NewTomlSource("typeError", []string{"./fixtures/formats"})
+	src.Extensions = FileExtensions
+
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                &StructPtr{},
+		DefaultPointersConfig: defaultPointersConfig(),
+		Run: func() error {
+			return nil
+		},
+	}
+
+	_, err := src.Parse(cmd)
+	require.Error(t, err)
+
+	tomlErr, ok := err.(*TomlError)
+	require.True(t, ok)
+	assert.Equal(t, src.ConfigFileUsed(), tomlErr.File)
+	assert.Equal(t, 0, tomlErr.Line)
+	assert.Equal(t, "PtrStruct1.S1Int", tomlErr.Key)
+}
+
+func Test_findFile_globSkipsOtherExtensions(t *testing.T) {
+	thisPath, _ := filepath.Abs(".")
+
+	result, attempts := findFile("", []string{"./fixtures/formats/conf.d/*"}, ".yaml")
+	assert.Empty(t, result)
+
+	expectedAttempts := []SearchAttempt{
+		{Path: filepath.Join(thisPath, "fixtures", "formats", "conf.d", "*")},
+	}
+	assert.Equal(t, expectedAttempts, attempts)
+}
@@ -0,0 +1,152 @@
+package staert
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// DefaultVersionKey is the default key of the configuration version
+const DefaultVersionKey = "version"
+
+// ConfigTree is the raw key tree of a source, before it is decoded into the config
+// Keys are dotted paths like "Section.Name", matched case insensitively.
+// Values are the ones decoded by the source: TOML values for TomlSource, strings for KvSource
+type ConfigTree map[string]interface{}
+
+// Get returns the value of the key
+func (t ConfigTree) Get(key string) (interface{}, bool) {
+	_, value, ok := findTreeKey(t, strings.Split(key, "."))
+	return value, ok
+}
+
+// Set sets the value of the key, creating the missing tables
+func (t ConfigTree) Set(key string, value interface{}) error {
+	path := strings.Split(key, ".")
+	if found, _, ok := findTreeKey(t, path); ok {
+		path = found
+	}
+	return setTreeKey(t, path, value)
+}
+
+// Delete deletes the key, it returns false if the key doesn't exist
+func (t ConfigTree) Delete(key string) bool {
+	path, _, ok := findTreeKey(t, strings.Split(key, "."))
+	if ok {
+		deleteTreeKey(t, path)
+	}
+	return ok
+}
+
+// Move moves the value of oldKey to newKey, it returns false if oldKey doesn't exist
+func (t ConfigTree) Move(oldKey, newKey string) (bool, error) {
+	value, ok := t.Get(oldKey)
+	if !ok {
+		return false, nil
+	}
+	t.Delete(oldKey)
+	return true, t.Set(newKey, value)
+}
+
+// UpgradeFunc upgrades the raw key tree of a configuration to the next version
+type UpgradeFunc func(tree ConfigTree) error
+
+// UpgradeNotice is emitted when a source is upgraded to the current configuration version
+type UpgradeNotice struct {
+	Source   string // "toml", "kv" or "http"
+	Location string // file and line or KV key of the version
+	From     int
+	To       int
+}
+
+func (n UpgradeNotice) String() string {
+	return fmt.Sprintf("%s: %s configuration upgraded from version %d to %d", n.Location, n.Source, n.From, n.To)
+}
+
+// AddUpgrade registers the upgrade of the configurations from version `from` to version from+1
+// TomlSource, KvSource and HTTPSource configurations with a version (see VersionKey) older than the current one,
+// the one following the last registered upgrade, are upgraded before being decoded.
+// The configurations without version are not upgraded
+func (s *Staert) AddUpgrade(from int, upgrade UpgradeFunc) {
+	if s.upgrades == nil {
+		s.upgrades = make(map[int]UpgradeFunc)
+	}
+	s.upgrades[from] = upgrade
+}
+
+// currentVersion returns the version following the last registered upgrade
+func (s *Staert) currentVersion() int {
+	current := 0
+	for from := range s.upgrades {
+		if from+1 > current {
+			current = from + 1
+		}
+	}
+	return current
+}
+
+// upgradeTree upgrades the raw key tree of a source to the current version
+func (s *Staert) upgradeTree(raw *rawTree) (bool, error) {
+	if len(s.upgrades) == 0 {
+		return false, nil
+	}
+	versionPath, value, ok := findTreeKey(raw.tree, strings.Split(s.VersionKey, "."))
+	if !ok {
+		return false, nil
+	}
+
+	version, err := parseVersion(value)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", raw.location(versionPath), err)
+	}
+	current := s.currentVersion()
+	if version >= current {
+		return false, nil
+	}
+
+	for from := version; from < current; from++ {
+		upgrade, ok := s.upgrades[from]
+		if !ok {
+			return false, fmt.Errorf("%s: no upgrade from configuration version %d", raw.location(versionPath), from)
+		}
+		if err := upgrade(ConfigTree(raw.tree)); err != nil {
+			return false, fmt.Errorf("%s: error upgrading configuration version %d: %v", raw.location(versionPath), from, err)
+		}
+	}
+
+	// the version keeps the type of the source
+	var upgradedVersion interface{} = int64(current)
+	if _, ok := value.(string); ok {
+		upgradedVersion = strconv.Itoa(current)
+	}
+	if err := setTreeKey(raw.tree, versionPath, upgradedVersion); err != nil {
+		return false, err
+	}
+
+	s.notifyUpgrade(UpgradeNotice{Source: raw.source, Location: raw.location(versionPath), From: version, To: current})
+	return true, nil
+}
+
+func (s *Staert) notifyUpgrade(notice UpgradeNotice) {
+	if s.OnUpgrade != nil {
+		s.OnUpgrade(notice)
+		return
+	}
+	log.Print(notice)
+}
+
+func parseVersion(value interface{}) (int, error) {
+	switch version := value.(type) {
+	case int64:
+		return int(version), nil
+	case string:
+		parsed, err := strconv.Atoi(version)
+		if err != nil {
+			return 0, fmt.Errorf("invalid configuration version %q", version)
+		}
+		return parsed, nil
+	default:
+		return 0, fmt.Errorf("invalid configuration version %v", value)
+	}
+}
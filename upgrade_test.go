@@ -0,0 +1,190 @@
+package staert
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/containous/flaeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type UpgradeConfig struct {
+	Version int           `description:"Version"`
+	Name    string        `description:"Name"`
+	Section *AliasSection `description:"Section"`
+}
+
+func newUpgradeStaert(config *UpgradeConfig) (*Staert, *[]UpgradeNotice) {
+	cmd := &flaeg.Command{
+		Name:                  "test",
+		Config:                config,
+		DefaultPointersConfig: &UpgradeConfig{Section: &AliasSection{NewName: "default"}},
+		Run: func() error {
+			return nil
+		},
+	}
+
+	s := NewStaert(cmd)
+	s.AddUpgrade(1, func(tree ConfigTree) error {
+		_, err := tree.Move("OldName", "Name")
+		return err
+	})
+	s.AddUpgrade(2, func(tree ConfigTree) error {
+		return tree.Set("Section.Count", int64(2))
+	})
+
+	var notices []UpgradeNotice
+	s.OnUpgrade = func(notice UpgradeNotice) {
+		notices = append(notices, notice)
+	}
+	return s, &notices
+}
+
+func TestUpgrade_toml(t *testing.T) {
+	config := &UpgradeConfig{}
+	s, notices := newUpgradeStaert(config)
+
+	toml := NewTomlSource("upgrade", []string{"./fixtures/"})
+	s.AddSource(toml)
+
+	_, err := s.LoadConfig()
+	require.NoError(t, err)
+
+	expected := &UpgradeConfig{
+		Version: 3,
+		Name:    "name",
+		Section: &AliasSection{NewName: "default", Count: 2},
+	}
+	assert.Equal(t, expected, config)
+
+	expectedNotices := []UpgradeNotice{
+		{Source: "toml", Location: toml.ConfigFileUsed() + ":2", From: 1, To: 3},
+	}
+	assert.Equal(t, expectedNotices, *notices)
+	assert.Equal(t, toml.ConfigFileUsed()+":2: toml configuration upgraded from version 1 to 3", (*notices)[0].String())
+}
+
+func TestUpgrade_kv(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		pairs           []*store.KVPair
+		expected        *UpgradeConfig
+		expectedNotices []UpgradeNotice
+	}{
+		{
+			desc: "from version 2",
+			pairs: []*store.KVPair{
+				{Key: "prefix/version", Value: []byte("2")},
+				{Key: "prefix/name", Value: []byte("name")},
+			},
+			expected: &UpgradeConfig{Version: 3, Name: "name", Section: &AliasSection{Count: 2}},
+			expectedNotices: []UpgradeNotice{
+				{Source: "kv", Location: "prefix/version", From: 2, To: 3},
+			},
+		},
+		{
+			desc: "current version",
+			pairs: []*store.KVPair{
+				{Key: "prefix/version", Value: []byte("3")},
+				{Key: "prefix/oldname", Value: []byte("name")},
+			},
+			expected: &UpgradeConfig{Version: 3},
+		},
+		{
+			desc: "without version",
+			pairs: []*store.KVPair{
+				{Key: "prefix/oldname", Value: []byte("name")},
+			},
+			expected: &UpgradeConfig{},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			config := &UpgradeConfig{}
+			s, notices := newUpgradeStaert(config)
+			s.AddSource(&KvSource{&Mock{KVPairs: test.pairs}, "prefix"})
+
+			_, err := s.LoadConfig()
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, config)
+			assert.Equal(t, test.expectedNotices, *notices)
+		})
+	}
+}
+
+func TestUpgrade_errors(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		version       string
+		upgrade       UpgradeFunc
+		expectedError string
+	}{
+		{
+			desc:          "invalid version",
+			version:       "v1",
+			expectedError: `prefix/version: invalid configuration version "v1"`,
+		},
+		{
+			desc:          "missing upgrade",
+			version:       "0",
+			expectedError: "prefix/version: no upgrade from configuration version 0",
+		},
+		{
+			desc:    "upgrade error",
+			version: "1",
+			upgrade: func(tree ConfigTree) error {
+				return errors.New("fail")
+			},
+			expectedError: "prefix/version: error upgrading configuration version 1: fail",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			s, _ := newUpgradeStaert(&UpgradeConfig{})
+			if test.upgrade != nil {
+				s.AddUpgrade(1, test.upgrade)
+			}
+			s.AddSource(&KvSource{&Mock{KVPairs: []*store.KVPair{{Key: "prefix/version", Value: []byte(test.version)}}}, "prefix"})
+
+			_, err := s.LoadConfig()
+			assert.EqualError(t, err, test.expectedError)
+		})
+	}
+}
+
+func TestConfigTree(t *testing.T) {
+	tree := ConfigTree{"Section": map[string]interface{}{"Name": "name"}}
+
+	value, ok := tree.Get("section.name")
+	require.True(t, ok)
+	assert.Equal(t, "name", value)
+
+	moved, err := tree.Move("section.name", "Other.Name")
+	require.NoError(t, err)
+	assert.True(t, moved)
+
+	moved, err = tree.Move("section.name", "Other.Name")
+	require.NoError(t, err)
+	assert.False(t, moved)
+
+	require.NoError(t, tree.Set("other.count", int64(2)))
+	assert.Equal(t, ConfigTree{
+		"Section": map[string]interface{}{},
+		"Other":   map[string]interface{}{"Name": "name", "count": int64(2)},
+	}, tree)
+
+	assert.Error(t, tree.Set("other.name.value", "value"))
+	assert.True(t, tree.Delete("OTHER"))
+	assert.False(t, tree.Delete("other"))
+}